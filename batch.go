@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// POST /_batch - несколько операций над любыми таблицами в одной транзакции:
+//
+//	{"operations": [
+//	  {"op": "create", "table": "orders", "body": {...}, "as": "order"},
+//	  {"op": "create", "table": "order_items", "body": {"order_id": {"$ref": "order.id"}, ...}},
+//	  {"op": "update", "table": "items", "id": 1, "body": {...}},
+//	  {"op": "delete", "table": "items", "id": {"$ref": "0"}}
+//	]}
+//
+// {"$ref": "$name.$field"} подставляет результат одной из предыдущих операций:
+// $name - её as или номер, $field - поле результата (ключ новой записи, updated, deleted),
+// без поля - результат целиком. На первой ошибке транзакция откатывается.
+
+const (
+	batchCreate = "create"
+	batchUpdate = "update"
+	batchDelete = "delete"
+
+	refField = "$ref"
+)
+
+type batchOperation struct {
+	Op    string                 `json:"op"`
+	Table string                 `json:"table"` // $table или $database/$table, как в пути
+	Id    interface{}            `json:"id"`    // $id как в пути, объект {$column: value} или ссылка
+	Body  map[string]interface{} `json:"body"`
+	As    string                 `json:"as"` // имя результата для ссылок
+}
+
+// batchResults - результаты уже выполненных операций
+type batchResults struct {
+	results []map[string]interface{}
+	names   map[string]int
+}
+
+// resolve заменяет ссылку {"$ref": ...} результатом, остальные значения возвращает как есть
+func (b *batchResults) resolve(value interface{}) (interface{}, error) {
+	obj, ok := value.(map[string]interface{})
+	if !ok || len(obj) != 1 {
+		return value, nil
+	}
+	rawRef, ok := obj[refField]
+	if !ok {
+		return value, nil
+	}
+	ref, ok := rawRef.(string)
+	if !ok {
+		return nil, DbError{statusCode: http.StatusBadRequest, err: errors.New("reference must be a string")}
+	}
+
+	name, field, hasField := strings.Cut(ref, ".")
+	unknown := DbError{statusCode: http.StatusBadRequest, err: fmt.Errorf("unknown reference %s", ref), code: "invalid_reference"}
+	index, ok := b.names[name]
+	if !ok {
+		i, err := strconv.Atoi(name)
+		if err != nil || i < 0 || i >= len(b.results) {
+			return nil, unknown
+		}
+		index = i
+	}
+	result := b.results[index]
+	if !hasField {
+		return result, nil
+	}
+	resolved, ok := result[field]
+	if !ok {
+		return nil, unknown
+	}
+	return resolved, nil
+}
+
+// recordKey - ключ записи из id операции: строка или число как $id в пути, объект - по колонкам
+func (b *batchResults) recordKey(table *Table, id interface{}) (recordKey, error) {
+	id, err := b.resolve(id)
+	if err != nil {
+		return nil, err
+	}
+	switch v := id.(type) {
+	case nil:
+		return nil, DbError{statusCode: http.StatusBadRequest, err: errors.New("id is required")}
+	case map[string]interface{}:
+		params := url.Values{}
+		for name, value := range v {
+			if value, err = b.resolve(value); err != nil {
+				return nil, err
+			}
+			params.Set(keyParamPrefix+name, fmt.Sprint(value))
+		}
+		return table.parseRecordKey("", params)
+	default:
+		return table.parseRecordKey(fmt.Sprint(v), nil)
+	}
+}
+
+func parseBatch(r *http.Request) ([]batchOperation, error) {
+	var request struct {
+		Operations []batchOperation `json:"operations"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&request); err != nil {
+		return nil, DbError{statusCode: http.StatusBadRequest, err: errors.New("invalid json body")}
+	}
+	if len(request.Operations) == 0 {
+		return nil, DbError{statusCode: http.StatusBadRequest, err: errors.New("operations are required")}
+	}
+	for i, op := range request.Operations {
+		request.Operations[i].Body = convertNumbers(op.Body)
+		if num, ok := op.Id.(json.Number); ok {
+			request.Operations[i].Id = convertNumber(num)
+		}
+	}
+	return request.Operations, nil
+}
+
+func (exp *DbExplorer) batchFunc(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	ops, err := parseBatch(r)
+	r.Body.Close()
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+
+	tx, err := exp.db.Begin()
+	if err != nil {
+		HandleError(w, DbError{statusCode: http.StatusInternalServerError, err: err})
+		return
+	}
+	defer tx.Rollback()
+
+	batch := &batchResults{results: make([]map[string]interface{}, 0, len(ops)), names: make(map[string]int)}
+	for i, op := range ops {
+		result, err := exp.execBatchOperation(tx, batch, op)
+		if err != nil {
+			HandleError(w, batchError(i, err))
+			return
+		}
+		if op.As != "" {
+			batch.names[op.As] = i
+		}
+		batch.results = append(batch.results, result)
+	}
+
+	if err := tx.Commit(); err != nil {
+		HandleError(w, DbError{statusCode: http.StatusInternalServerError, err: err})
+		return
+	}
+	data := make(map[string]interface{})
+	data["results"] = batch.results
+	SendResponse(w, data)
+}
+
+// execBatchOperation выполняет одну операцию так же, как соответствующий маршрут, но в транзакции
+func (exp *DbExplorer) execBatchOperation(conn dbConn, batch *batchResults, op batchOperation) (map[string]interface{}, error) {
+	segments := strings.Split(strings.Trim(op.Table, "/"), "/")
+	table, rest, err := exp.getSchema().ResolveTable(segments)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, DbError{statusCode: http.StatusNotFound, err: errors.New("unknown table")}
+	}
+	if op.As != "" {
+		if _, exist := batch.names[op.As]; exist {
+			str := fmt.Sprintf("duplicate name %s", op.As)
+			return nil, DbError{statusCode: http.StatusBadRequest, err: errors.New(str)}
+		}
+	}
+
+	body := make(map[string]interface{}, len(op.Body))
+	for name, value := range op.Body {
+		if body[name], err = batch.resolve(value); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make(map[string]interface{})
+	switch op.Op {
+	case batchCreate:
+		if err := table.requirePrimaryKey(); err != nil {
+			return nil, err
+		}
+		keys, values, err := exp.Validate(body, table, payloadInsert)
+		if err != nil {
+			return nil, err
+		}
+		id, err := insertRow(conn, table, keys, values)
+		if err != nil {
+			return nil, err
+		}
+		result = insertedKey(table, body, id)
+	case batchUpdate:
+		key, err := batch.recordKey(table, op.Id)
+		if err != nil {
+			return nil, err
+		}
+		keys, values, err := exp.Validate(body, table, payloadUpdate)
+		if err != nil {
+			return nil, err
+		}
+		setValues := make([]string, 0, len(keys))
+		for _, name := range keys {
+			setValues = append(setValues, quoteIdent(name)+" = ?")
+		}
+		affected, err := updateRow(conn, table, key, setValues, values, nil)
+		if err != nil {
+			return nil, err
+		}
+		result["updated"] = affected
+	case batchDelete:
+		key, err := batch.recordKey(table, op.Id)
+		if err != nil {
+			return nil, err
+		}
+		affected, err := deleteRow(conn, table, key, nil)
+		if err != nil {
+			return nil, err
+		}
+		result["deleted"] = affected
+	default:
+		str := fmt.Sprintf("unknown batch op %s", op.Op)
+		return nil, DbError{statusCode: http.StatusBadRequest, err: errors.New(str)}
+	}
+	return result, nil
+}
+
+// batchError - ошибка операции с её номером, статус и код сохраняются, поля - вида $index.$column
+func batchError(index int, err error) DbError {
+	e := toDbError(err)
+	str := fmt.Sprintf("operation %d: %s", index, e.Error())
+	var details []fieldError
+	for _, detail := range e.details {
+		detail.Field = fmt.Sprintf("%d.%s", index, detail.Field)
+		details = append(details, detail)
+	}
+	field := e.field
+	if field != "" {
+		field = fmt.Sprintf("%d.%s", index, field)
+	}
+	return DbError{statusCode: e.statusCode, err: errors.New(str), code: e.code, field: field, details: details}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Массовая вставка на маршруте создания: тело - json-массив объектов
+// или NDJSON (Content-Type: application/x-ndjson), по объекту на строку.
+// Строки проверяются через Validate и вставляются пачками многострочных
+// INSERT в одной транзакции. ?mode=atomic (по умолчанию) - всё или ничего,
+// ?mode=best_effort - вставляется всё, что можно, ошибки возвращаются по строкам.
+
+const (
+	bulkBatchSize      = 500
+	maxPlaceholders    = 65535    // ограничение протокола mysql на число ? в запросе
+	maxBulkBodySize    = 64 << 20 // тело массовой вставки читается в память целиком
+	maxBulkRows        = 10000
+	bulkModeAtomic     = "atomic"
+	bulkModeBestEffort = "best_effort"
+)
+
+// bulkRow - проверенная строка тела
+type bulkRow struct {
+	index  int
+	body   map[string]interface{}
+	keys   []string
+	values []interface{}
+}
+
+// bulkResult - итог по одной строке: ключ вставленной записи или ошибка
+type bulkResult struct {
+	Index   int                    `json:"index"`
+	Key     map[string]interface{} `json:"key,omitempty"`
+	Error   string                 `json:"error,omitempty"`
+	Code    string                 `json:"code,omitempty"`
+	Details []fieldError           `json:"details,omitempty"`
+}
+
+func (res *bulkResult) fail(err error) {
+	e := toDbError(err)
+	res.Error = e.Error()
+	res.Code = e.code
+	if res.Code == "" {
+		res.Code = errorCode(e.statusCode)
+	}
+	res.Details = e.details
+}
+
+// bulkBody - тело запроса, в котором можно подсмотреть первый символ
+type bulkBody struct {
+	*bufio.Reader
+	io.Closer
+}
+
+func isNDJSON(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/x-ndjson" || mediaType == "application/ndjson"
+}
+
+// isBulk определяет массовую вставку по Content-Type или по '[' в начале тела
+func isBulk(r *http.Request) bool {
+	if isNDJSON(r) {
+		return true
+	}
+	body := bulkBody{Reader: bufio.NewReader(r.Body), Closer: r.Body}
+	r.Body = body
+	for {
+		b, err := body.Peek(1)
+		if err != nil {
+			return false
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			body.ReadByte()
+		default:
+			return b[0] == '['
+		}
+	}
+}
+
+// parseBulkBody читает строки из json-массива или NDJSON, не больше maxBulkRows.
+// Вместо строки, которая не является объектом, возвращается nil.
+func parseBulkBody(r *http.Request) ([]map[string]interface{}, error) {
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	rows := make([]map[string]interface{}, 0)
+	// bodyError - ошибка чтения: превышен размер тела или битый json
+	bodyError := func(err error) error {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			str := fmt.Sprintf("request body too large, limit is %d bytes", tooLarge.Limit)
+			return DbError{statusCode: http.StatusRequestEntityTooLarge, err: errors.New(str)}
+		}
+		return DbError{statusCode: http.StatusBadRequest, err: errors.New("invalid json body")}
+	}
+	tooMany := DbError{statusCode: http.StatusRequestEntityTooLarge, err: fmt.Errorf("too many rows, limit is %d", maxBulkRows)}
+
+	ndjson := isNDJSON(r)
+	if !ndjson {
+		if token, err := decoder.Token(); err != nil || token != json.Delim('[') {
+			return nil, bodyError(err)
+		}
+	}
+	for {
+		if !ndjson && !decoder.More() {
+			break
+		}
+		var value interface{}
+		err := decoder.Decode(&value)
+		if ndjson && err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, bodyError(err)
+		}
+		if len(rows) == maxBulkRows {
+			return nil, tooMany
+		}
+		// не объект (null, число, массив) - nil, ошибка будет у этой строки
+		row, ok := value.(map[string]interface{})
+		if ok {
+			row = convertNumbers(row)
+		}
+		rows = append(rows, row)
+	}
+	if !ndjson {
+		if _, err := decoder.Token(); err != nil { // закрывающая ]
+			return nil, bodyError(err)
+		}
+	}
+	return rows, nil
+}
+
+// insertedKey - ключ новой записи: auto increment из базы, остальное из тела
+func insertedKey(table *Table, body map[string]interface{}, id int64) map[string]interface{} {
+	key := make(map[string]interface{}, len(table.PrimaryKey))
+	for _, name := range table.PrimaryKey {
+		if column, _ := table.Column(name); column.AutoIncrement {
+			key[name] = id
+		} else {
+			key[name] = body[name]
+		}
+	}
+	return key
+}
+
+// insertBatch вставляет строки одним INSERT, колонки - объединение колонок строк,
+// отсутствующие в строке получают DEFAULT. Возвращает id первой строки.
+func insertBatch(tx *sql.Tx, table *Table, rows []*bulkRow) (int64, error) {
+	columns := make([]string, 0, len(table.Columns))
+	for _, column := range table.Columns {
+		for _, row := range rows {
+			if Contains(row.keys, column.Name) {
+				columns = append(columns, column.Name)
+				break
+			}
+		}
+	}
+
+	tuples := make([]string, 0, len(rows))
+	args := make([]interface{}, 0, len(rows)*len(columns))
+	for _, row := range rows {
+		placeholders := make([]string, 0, len(columns))
+		for _, name := range columns {
+			if i := IndexOf(row.keys, name); i >= 0 {
+				placeholders = append(placeholders, "?")
+				args = append(args, row.values[i])
+			} else {
+				placeholders = append(placeholders, "DEFAULT")
+			}
+		}
+		tuples = append(tuples, "("+strings.Join(placeholders, ", ")+")")
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", table.FullName(), strings.Join(quoteIdents(columns), ", "), strings.Join(tuples, ", "))
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (exp *DbExplorer) BulkCreate(w http.ResponseWriter, r *http.Request, table *Table) {
+	if err := table.requirePrimaryKey(); err != nil {
+		HandleError(w, err)
+		return
+	}
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = bulkModeAtomic
+	}
+	if mode != bulkModeAtomic && mode != bulkModeBestEffort {
+		HandleError(w, DbError{statusCode: http.StatusBadRequest, err: errors.New("mode must be atomic or best_effort")})
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBulkBodySize)
+	bodies, err := parseBulkBody(r)
+	r.Body.Close()
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+
+	results := make([]bulkResult, len(bodies))
+	rows := make([]*bulkRow, 0, len(bodies))
+	failed := 0
+	validator := exp.newValidator(table, payloadInsert)
+	for i, body := range bodies {
+		results[i].Index = i
+		if body == nil {
+			results[i].fail(DbError{statusCode: http.StatusBadRequest, err: errors.New("invalid json body")})
+			failed++
+			continue
+		}
+		keys, values, err := validator.Validate(body)
+		if err != nil {
+			results[i].fail(err)
+			failed++
+			continue
+		}
+		rows = append(rows, &bulkRow{index: i, body: body, keys: keys, values: values})
+	}
+	if failed > 0 && mode == bulkModeAtomic {
+		HandleError(w, bulkError(results, http.StatusBadRequest))
+		return
+	}
+
+	tx, err := exp.db.Begin()
+	if err != nil {
+		HandleError(w, DbError{statusCode: http.StatusInternalServerError, err: err})
+		return
+	}
+	defer tx.Rollback()
+
+	// id в многострочном INSERT идут подряд с шагом auto_increment_increment
+	var increment int64 = 1
+	if err := tx.QueryRow("SELECT @@auto_increment_increment").Scan(&increment); err != nil {
+		HandleError(w, DbError{statusCode: http.StatusInternalServerError, err: err})
+		return
+	}
+
+	batchSize := bulkBatchSize
+	if perRow := len(table.Columns); perRow > 0 && batchSize*perRow > maxPlaceholders {
+		batchSize = maxPlaceholders / perRow
+	}
+	for start := 0; start < len(rows); start += batchSize {
+		end := start + batchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		batch := rows[start:end]
+		if id, err := insertBatch(tx, table, batch); err == nil {
+			for i, row := range batch {
+				results[row.index].Key = insertedKey(table, row.body, id+int64(i)*increment)
+			}
+			continue
+		}
+		// пачка не вставилась - повторяем по одной строке, чтобы понять, какая виновата.
+		// Ошибка запроса в mysql не прерывает транзакцию.
+		for _, row := range batch {
+			id, err := insertBatch(tx, table, []*bulkRow{row})
+			if err != nil {
+				results[row.index].fail(err)
+				failed++
+				if mode == bulkModeAtomic {
+					HandleError(w, bulkError(results, toDbError(err).statusCode))
+					return
+				}
+				continue
+			}
+			results[row.index].Key = insertedKey(table, row.body, id)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		HandleError(w, DbError{statusCode: http.StatusInternalServerError, err: err})
+		return
+	}
+
+	status := http.StatusCreated
+	if failed > 0 {
+		status = http.StatusOK // best_effort с ошибками: часть строк не вставлена
+	}
+	data := make(map[string]interface{})
+	data["inserted"] = len(bodies) - failed
+	data["failed"] = failed
+	data["records"] = results
+	SendResponseStatus(w, status, data)
+}
+
+// bulkError - ошибка atomic-вставки со списком неудачных строк, поле вида $index.$column
+func bulkError(results []bulkResult, status int) DbError {
+	messages := make([]string, 0)
+	details := make([]fieldError, 0)
+	for _, res := range results {
+		if res.Error == "" {
+			continue
+		}
+		messages = append(messages, fmt.Sprintf("row %d: %s", res.Index, res.Error))
+		if len(res.Details) == 0 {
+			details = append(details, fieldError{Field: fmt.Sprint(res.Index), Code: res.Code, Message: res.Error})
+		}
+		for _, detail := range res.Details {
+			detail.Field = fmt.Sprintf("%d.%s", res.Index, detail.Field)
+			details = append(details, detail)
+		}
+	}
+	return DbError{statusCode: status, err: errors.New(strings.Join(messages, "; ")), code: "bulk_failed", details: details}
+}
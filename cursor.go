@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// cursorToken - содержимое непрозрачного курсора ?cursor=...
+// Хранит значения колонок сортировки у крайней строки страницы.
+type cursorToken struct {
+	Sort   string        `json:"s"`
+	Prev   bool          `json:"p,omitempty"`
+	Values []interface{} `json:"v"`
+}
+
+func encodeCursor(sort Sort, prev bool, record map[string]interface{}) string {
+	token := cursorToken{Sort: sort.String(), Prev: prev}
+	for _, field := range sort {
+		token.Values = append(token.Values, record[field.column])
+	}
+	data, _ := json.Marshal(token)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor проверяет, что курсор выдан для той же сортировки,
+// и приводит сохранённые значения обратно к виду для запроса
+func (t *Table) decodeCursor(raw string, sort Sort) (*cursorToken, error) {
+	invalidCursor := DbError{statusCode: http.StatusBadRequest, err: errors.New("invalid cursor")}
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, invalidCursor
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	token := &cursorToken{}
+	if err := decoder.Decode(token); err != nil {
+		return nil, invalidCursor
+	}
+	if token.Sort != sort.String() || len(token.Values) != len(sort) {
+		return nil, DbError{statusCode: http.StatusBadRequest, err: errors.New("cursor does not match sort")}
+	}
+	for i, field := range sort {
+		value := token.Values[i]
+		if value == nil {
+			continue
+		}
+		column, _ := t.Column(field.column)
+		if num, ok := value.(json.Number); ok {
+			value = convertNumber(num)
+		}
+		dbValue, ok := column.toDbValue(value)
+		if !ok {
+			return nil, invalidCursor
+		}
+		token.Values[i] = dbValue
+	}
+	return token, nil
+}
+
+func (s Sort) String() string {
+	fields := make([]string, 0, len(s))
+	for _, field := range s {
+		if field.desc {
+			fields = append(fields, "-"+field.column)
+		} else {
+			fields = append(fields, field.column)
+		}
+	}
+	return strings.Join(fields, ",")
+}
+
+// reverse - обратный порядок, по нему выбираем предыдущую страницу
+func (s Sort) reverse() Sort {
+	res := make(Sort, 0, len(s))
+	for _, field := range s {
+		res = append(res, sortField{column: field.column, desc: !field.desc})
+	}
+	return res
+}
+
+// after - условие "строка идёт после values в порядке s".
+// Раскрывается в (c1 > v1) OR (c1 = v1 AND c2 > v2) OR ...
+// NULL в mysql меньше любого значения: при ASC идут первыми, при DESC последними.
+func (s Sort) after(values []interface{}) (string, []interface{}) {
+	disjuncts := make([]string, 0, len(s))
+	args := make([]interface{}, 0)
+	for i, field := range s {
+		conditions := make([]string, 0, i+1)
+		conditionArgs := make([]interface{}, 0, i+1)
+		for j := 0; j < i; j++ {
+			column := quoteIdent(s[j].column)
+			if values[j] == nil {
+				conditions = append(conditions, column+" IS NULL")
+			} else {
+				conditions = append(conditions, column+" = ?")
+				conditionArgs = append(conditionArgs, values[j])
+			}
+		}
+
+		column := quoteIdent(field.column)
+		switch {
+		case values[i] == nil && field.desc:
+			continue // после NULL при DESC ничего нет
+		case values[i] == nil:
+			conditions = append(conditions, column+" IS NOT NULL")
+		case field.desc:
+			conditions = append(conditions, "("+column+" < ? OR "+column+" IS NULL)")
+			conditionArgs = append(conditionArgs, values[i])
+		default:
+			conditions = append(conditions, column+" > ?")
+			conditionArgs = append(conditionArgs, values[i])
+		}
+		disjuncts = append(disjuncts, "("+strings.Join(conditions, " AND ")+")")
+		args = append(args, conditionArgs...)
+	}
+	if len(disjuncts) == 0 {
+		return "1 = 0", nil
+	}
+	return "(" + strings.Join(disjuncts, " OR ") + ")", args
+}
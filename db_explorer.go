@@ -6,157 +6,341 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"reflect"
-	"strconv"
 	"strings"
+	"sync"
 )
 
 // тут вы пишете код
 // обращаю ваше внимание - в этом задании запрещены глобальные переменные
 
+// dbConn - то, через что выполняются запросы: *sql.DB или *sql.Tx в /_batch
+type dbConn interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
 type DbExplorer struct {
 	db     *sql.DB
 	router *http.ServeMux
+
+	mu         sync.RWMutex
+	schema     *Schema
+	visibility visibility
+	routing    RoutingMode
+
+	reloadEndpoint bool
+
+	maxAffectedRows int
 }
 
 func (exp *DbExplorer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	exp.router.ServeHTTP(w, r)
+	exp.router.ServeHTTP(newErrorWriter(w, r), r)
 }
 
-func NewDbExplorer(db *sql.DB) (*DbExplorer, error) {
-	exp := &DbExplorer{db: db, router: http.NewServeMux()}
+func NewDbExplorer(db *sql.DB, options ...Option) (*DbExplorer, error) {
+	exp := &DbExplorer{db: db, router: http.NewServeMux(), maxAffectedRows: defaultMaxAffectedRows}
+	for _, option := range options {
+		option(exp)
+	}
+	if exp.maxAffectedRows <= 0 {
+		return nil, fmt.Errorf("max affected rows must be positive, got %d", exp.maxAffectedRows)
+	}
+	if err := exp.Reload(); err != nil {
+		return nil, err
+	}
+	if exp.reloadEndpoint {
+		exp.router.HandleFunc("/_reload", exp.reloadFunc)
+	}
+	exp.router.HandleFunc("/_openapi.json", exp.openAPIFunc)
+	exp.router.HandleFunc("/_batch", exp.batchFunc)
 	exp.router.HandleFunc("/", exp.listFunc)
 	return exp, nil
 }
 
 func SendResponse(w http.ResponseWriter, data any) {
-	//w.WriteHeader(http.StatusOK)
+	SendResponseStatus(w, http.StatusOK, data)
+}
+
+func SendResponseStatus(w http.ResponseWriter, status int, data any) {
 	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(status)
 	response := make(map[string]interface{})
 	response["response"] = data
 	json.NewEncoder(w).Encode(response)
 }
 
 func (exp *DbExplorer) AllTables(w http.ResponseWriter, r *http.Request) {
-	data, err := getTables(exp.db)
-	if err != nil {
-		HandleError(w, DbError{statusCode: http.StatusInternalServerError, err: err})
-		return
+	schema := exp.getSchema()
+	data := make(map[string]interface{})
+	data["tables"] = schema.RouteNames()
+	data["databases"] = schema.TableNames()
+	if retrieveFlag(r.FormValue("meta")) {
+		info, err := exp.tablesInfo(schema)
+		if err != nil {
+			HandleError(w, DbError{statusCode: http.StatusInternalServerError, err: err})
+			return
+		}
+		data["info"] = info
 	}
 	SendResponse(w, data)
 }
 
-func (exp *DbExplorer) Validate(body map[string]interface{}, databaseName, tableName string, method string) ([]string, []interface{}, error) {
+// Validate проверяет тело по JSON Schema таблицы (та же, что отдаётся на /$table/_schema/$payload)
+// и приводит значения к виду для запроса. Неизвестные поля игнорируются,
+// в ошибке перечисляются все неподходящие поля сразу.
+func (exp *DbExplorer) Validate(body map[string]interface{}, table *Table, payload string) ([]string, []interface{}, error) {
+	return exp.newValidator(table, payload).Validate(body)
+}
 
-	references, err := getReference(exp.db, databaseName, tableName)
-	if err != nil {
-		return nil, nil, err
-	}
+func (v *payloadValidator) Validate(body map[string]interface{}) ([]string, []interface{}, error) {
+	table, payload := v.table, v.payload
+	errs := validatePayload(v.schema, v.patterns, table, body)
 
 	keys := make([]string, 0)
 	values := make([]interface{}, 0)
-
-	primaryKey, err := getPrimaryKey(exp.db, databaseName, tableName)
-	if err != nil {
-		return nil, nil, DbError{statusCode: http.StatusNotFound, err: errors.New("not found primary key")}
-	}
-
-	for key, value := range body { // информация пришедшая из запроса
-		aType, isKnownField := references[key]
-		if !isKnownField { // ignore unknown field
+	for _, column := range table.Columns {
+		value, exist := body[column.Name]
+		if !exist || hasFieldError(errs, column.Name) {
 			continue
 		}
-		if key == primaryKey && method == "POST" { // не можем менять primary key
-			str := fmt.Sprintf("field %s have invalid type", key)
-			return nil, nil, DbError{statusCode: http.StatusBadRequest, err: errors.New(str)}
-		} else if (method == "PUT") && (key == primaryKey) && isIdAutoIncrement(exp.db, primaryKey, databaseName, tableName) {
+		if payload == payloadInsert && table.IsPrimaryKey(column.Name) && column.AutoIncrement {
+			continue // ключ выдаёт база
+		}
+		if value == nil {
+			keys = append(keys, column.Name)
+			values = append(values, nil)
 			continue
-		} else if (value == nil && aType.IsNullable) || aType.Type == reflect.TypeOf(value) { // nil value
-			keys = append(keys, key)
-			values = append(values, value)
-		} else {
-			str := fmt.Sprintf("field %s have invalid type", key)
-			return nil, nil, DbError{statusCode: http.StatusBadRequest, err: errors.New(str)}
 		}
+		dbValue, ok := column.toDbValue(value)
+		if !ok {
+			errs = append(errs, fieldError{Field: column.Name, Code: "invalid_type", Message: fmt.Sprintf("field %s have invalid type", column.Name)})
+			continue
+		}
+		keys = append(keys, column.Name)
+		values = append(values, dbValue)
+	}
+	if len(errs) > 0 {
+		return nil, nil, validationError(errs)
 	}
-
-	// for fieldName, aType := range references {
-	// 	value, exist := body[fieldName]
-	// 	if exist && (fieldName == primaryKey) && (method == "POST") { // не можем менять primary key
-	// 		str := fmt.Sprintf("field %s have invalid type", fieldName)
-	// 		return nil, nil, DbError{statusCode: http.StatusBadRequest, err: errors.New(str)}
-	// 	} else if (method == "PUT") && (fieldName == primaryKey) && isIdAutoIncrement(exp.db, primaryKey, databaseName, tableName) {
-	// 		continue
-	// 	} else if (value == nil && aType.IsNullable) || (aType.Type == reflect.TypeOf(value)) || !exist {
-	// 		keys = append(keys, fieldName)
-	// 		values = append(values, value)
-	// 	} else {
-	// 		str := fmt.Sprintf("field %s have invalid type", fieldName)
-	// 		return nil, nil, DbError{statusCode: http.StatusBadRequest, err: errors.New(str)}
-	// 	}
-	// }
-
 	return keys, values, nil
 }
 
-func (exp *DbExplorer) List(w http.ResponseWriter, r *http.Request, tableName string) {
-	databaseName, err := findDatabase(tableName, exp.db)
+func (exp *DbExplorer) List(w http.ResponseWriter, r *http.Request, table *Table) {
+	filter, err := table.parseFilter(r.URL.Query())
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+	sort, err := table.parseSort(r.FormValue("sort"))
 	if err != nil {
 		HandleError(w, err)
 		return
 	}
-	limit := retrieveParam(r.FormValue("limit"), 5)
-	offset := retrieveParam(r.FormValue("offset"), 0)
+	fields, err := table.parseFields(r.FormValue("fields"))
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+	limit := retrieveLimit(r)
+	offset := retrieveOffset(r)
+	withMeta := retrieveFlag(r.FormValue("meta"))
+	// ETag каждой строки для If-Match, только у таблиц с ключом: без него записи не изменить
+	withETags := retrieveFlag(r.FormValue("etag")) && len(table.PrimaryKey) > 0
+
+	// ?cursor= включает постраничный вывод по ключу вместо offset
+	_, cursorMode := r.URL.Query()["cursor"]
+	var cursor *cursorToken
+	if cursorMode {
+		if len(sort) == 0 {
+			HandleError(w, DbError{statusCode: http.StatusBadRequest, err: errors.New("cursor requires sort or primary key")})
+			return
+		}
+		if raw := r.FormValue("cursor"); raw != "" {
+			cursor, err = table.decodeCursor(raw, sort)
+			if err != nil {
+				HandleError(w, err)
+				return
+			}
+		}
+	}
+
+	var page *pageInfo
+	if totalType := r.FormValue("total"); withMeta || totalType != "" {
+		page = &pageInfo{Limit: limit}
+		if totalType != "" {
+			total, err := exp.countRecords(table, filter, totalType)
+			if err != nil {
+				HandleError(w, err)
+				return
+			}
+			page.Total = &total
+			page.TotalType = totalType
+		}
+	}
 
-	query := fmt.Sprintf("SELECT * FROM %s.%s LIMIT ? OFFSET ?", databaseName, tableName)
-	rows, err := exp.db.Query(query, limit, offset)
+	querySort := sort
+	if cursor != nil && cursor.Prev {
+		querySort = sort.reverse()
+	}
+	conditions := make([]string, 0)
+	condition, args := filter.where()
+	if condition != "" {
+		conditions = append(conditions, condition)
+	}
+	if cursor != nil {
+		condition, cursorArgs := querySort.after(cursor.Values)
+		conditions = append(conditions, condition)
+		args = append(args, cursorArgs...)
+	}
+
+	// колонки сортировки нужны для курсора, даже если их не просили в fields
+	sortColumns := make([]string, 0, len(sort))
+	if cursorMode {
+		for _, field := range sort {
+			sortColumns = append(sortColumns, field.column)
+		}
+	}
+	selected := selectList(fields, sortColumns...)
+	if withETags {
+		selected += fmt.Sprintf(", %s AS %s", table.rowVersion(), quoteIdent(etagColumn))
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s", selected, table.FullName())
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	if len(querySort) > 0 { // у таблицы без ключа и без ?sort порядок не задаём
+		query += " ORDER BY " + querySort.orderBy()
+	}
+	if cursorMode {
+		query += " LIMIT ?"
+		args = append(args, limit+1) // лишняя строка показывает, есть ли следующая страница
+	} else {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, limit, offset)
+	}
+	rows, err := exp.db.Query(query, args...)
 	if err != nil {
 		HandleError(w, DbError{statusCode: http.StatusInternalServerError, err: err})
 		return
 	}
 	defer rows.Close()
-	records, err := Pack(rows) // невалидный id нужно обработать
+	data := make(map[string]interface{})
+	if withMeta {
+		columns, err := PackColumns(rows, table)
+		if err != nil {
+			HandleError(w, DbError{statusCode: http.StatusInternalServerError, err: err})
+			return
+		}
+		visible := make([]*ResultColumn, 0, len(columns))
+		for _, column := range columns {
+			if column.Name != etagColumn {
+				visible = append(visible, column)
+			}
+		}
+		data["columns"] = visible
+	}
+	records, err := Pack(rows, table)
 	if err != nil {
 		HandleError(w, err)
 		return
 	}
-	data := make(map[string]interface{})
+	if withETags {
+		for _, record := range records {
+			record[listETagField] = takeRowETag(record)
+		}
+	}
+
+	if cursorMode {
+		hasMore := len(records) > limit
+		if hasMore {
+			records = records[:limit]
+		}
+		if cursor != nil && cursor.Prev {
+			for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+				records[i], records[j] = records[j], records[i]
+			}
+		}
+		if len(records) > 0 {
+			if hasMore || (cursor != nil && cursor.Prev) {
+				data["next"] = encodeCursor(sort, false, records[len(records)-1])
+			}
+			if cursor != nil && (!cursor.Prev || hasMore) {
+				data["prev"] = encodeCursor(sort, true, records[0])
+			}
+		}
+	}
+	if fields != nil {
+		for _, name := range sortColumns {
+			if Contains(fields, name) {
+				continue
+			}
+			for _, record := range records {
+				delete(record, name)
+			}
+		}
+	}
+	if page != nil {
+		if cursorMode {
+			if next, ok := data["next"].(string); ok {
+				page.Next = pageLink(r, map[string]string{"cursor": next})
+			}
+			if prev, ok := data["prev"].(string); ok {
+				page.Prev = pageLink(r, map[string]string{"cursor": prev})
+			}
+		} else {
+			page.Offset = &offset
+			offsetLinks(r, page, offset, len(records))
+		}
+		data["page"] = page
+	}
 	data["records"] = records
+	if notModified(w, r, responseETag(data)) {
+		return
+	}
 	SendResponse(w, data)
 }
 
-func (exp *DbExplorer) RecordById(w http.ResponseWriter, r *http.Request, tableName string, id int) {
-	databaseName, err := findDatabase(tableName, exp.db)
-	if err != nil || len(databaseName) == 0 {
-		HandleError(w, DbError{statusCode: http.StatusNotFound, err: errors.New("not found such table")})
+func (exp *DbExplorer) RecordById(w http.ResponseWriter, r *http.Request, table *Table, rawId string) {
+	key, err := table.parseRecordKey(rawId, r.URL.Query())
+	if err != nil {
+		HandleError(w, err)
 		return
 	}
-	primaryKey, err := getPrimaryKey(exp.db, databaseName, tableName)
+	fields, err := table.parseFields(r.FormValue("fields"))
 	if err != nil {
-		HandleError(w, DbError{statusCode: http.StatusNotFound, err: errors.New("not found primary key")})
+		HandleError(w, err)
 		return
 	}
-	query := fmt.Sprintf("SELECT * FROM %s.%s WHERE %s = ?;", databaseName, tableName, primaryKey)
-	rows, err := exp.db.Query(query, id)
+	condition, args := table.keyCondition(key)
+	query := fmt.Sprintf("SELECT %s, %s AS %s FROM %s WHERE %s;", selectList(fields), table.rowVersion(), quoteIdent(etagColumn), table.FullName(), condition)
+	rows, err := exp.db.Query(query, args...)
 	if err != nil {
-		HandleError(w, DbError{statusCode: http.StatusNotFound, err: err})
+		HandleError(w, DbError{statusCode: http.StatusInternalServerError, err: err})
 		return
 	}
 	defer rows.Close()
-	records, err := Pack(rows) // невалидный id нужно обработать
+	records, err := Pack(rows, table)
 	if err != nil {
 		HandleError(w, err)
 		return
 	}
+	if len(records) == 0 {
+		HandleError(w, DbError{statusCode: http.StatusNotFound, err: errors.New("record not found")})
+		return
+	}
+	record := records[0]
+	etag := takeRowETag(record)
+	if notModified(w, r, etag) {
+		return
+	}
 	data := make(map[string]interface{})
-	data["record"] = records[0]
+	data["record"] = record
 	SendResponse(w, data)
 }
 
-func (exp *DbExplorer) CreateRecord(w http.ResponseWriter, r *http.Request, tableName string) {
-	databaseName, err := findDatabase(tableName, exp.db)
-	if err != nil || len(databaseName) == 0 {
-		HandleError(w, DbError{statusCode: http.StatusNotFound, err: errors.New("not found such table")})
+func (exp *DbExplorer) CreateRecord(w http.ResponseWriter, r *http.Request, table *Table) {
+	if err := table.requirePrimaryKey(); err != nil {
+		HandleError(w, err)
 		return
 	}
 	body, err := jsonBodyParser(r.Body)
@@ -166,114 +350,243 @@ func (exp *DbExplorer) CreateRecord(w http.ResponseWriter, r *http.Request, tabl
 		return
 	}
 
-	primaryKey, err := getPrimaryKey(exp.db, databaseName, tableName)
+	keys, values, err := exp.Validate(body, table, payloadInsert)
 	if err != nil {
-		HandleError(w, DbError{statusCode: http.StatusNotFound, err: errors.New("not found primary key")})
+		HandleError(w, err)
 		return
 	}
 
-	keys, values, err := exp.Validate(body, databaseName, tableName, r.Method)
+	id, err := insertRow(exp.db, table, keys, values)
 	if err != nil {
 		HandleError(w, err)
 		return
 	}
 
-	questionMark := strings.Repeat("?, ", len(values)-1)
-	questionMark += "?"
-	query := fmt.Sprintf("INSERT INTO %s.%s (%s) VALUES (%s)", databaseName, tableName, strings.Join(keys, ","), questionMark)
-	result, err := exp.db.Exec(query, values...)
+	// auto increment колонку берём из LastInsertId, остальные части ключа - из тела запроса
+	data := insertedKey(table, body, id)
+	w.Header().Set("Location", exp.getSchema().recordPath(table, data))
+	SendResponseStatus(w, http.StatusCreated, data)
+}
+
+// insertRow - INSERT одной записи, возвращает LastInsertId
+func insertRow(conn dbConn, table *Table, keys []string, values []interface{}) (int64, error) {
+	// пустое тело - строка из одних default, INSERT INTO t () VALUES ()
+	questionMark := strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table.FullName(), strings.Join(quoteIdents(keys), ","), questionMark)
+	result, err := conn.Exec(query, values...)
+	if err != nil {
+		return 0, DbError{statusCode: http.StatusInternalServerError, err: err}
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, DbError{statusCode: http.StatusInternalServerError, err: err}
+	}
+	return id, nil
+}
+
+func (exp *DbExplorer) UpdateRecord(w http.ResponseWriter, r *http.Request, table *Table, rawId string) {
+	key, err := table.parseRecordKey(rawId, r.URL.Query())
 	if err != nil {
-		HandleError(w, DbError{statusCode: http.StatusInternalServerError, err: err})
+		HandleError(w, err)
 		return
 	}
 
-	id, err := result.LastInsertId()
+	body, err := jsonBodyParser(r.Body)
+	r.Body.Close() // обязательно закрыть сразу, т.к повторой подключение к бд течет, хз почему
 	if err != nil {
-		HandleError(w, DbError{statusCode: http.StatusInternalServerError, err: err})
+		HandleError(w, err)
+		return
+	}
+
+	keys, values, err := exp.Validate(body, table, payloadUpdate)
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+
+	setValues := make([]string, 0, len(keys))
+	for _, name := range keys {
+		setValues = append(setValues, quoteIdent(name)+" = ?")
+	}
+	affected, err := updateRow(exp.db, table, key, setValues, values, table.preconditions(r))
+	if err != nil {
+		HandleError(w, err)
 		return
 	}
 
 	data := make(map[string]int64, 1)
-	data[primaryKey] = id
+	data["updated"] = affected
 	SendResponse(w, data)
 }
 
-func (exp *DbExplorer) UpdateRecord(w http.ResponseWriter, r *http.Request, tableName string, id int) {
-	databaseName, err := findDatabase(tableName, exp.db)
-	if err != nil || len(databaseName) == 0 {
-		HandleError(w, DbError{statusCode: http.StatusNotFound, err: errors.New("not found such table")})
+// ReplaceRecord - PUT /$table/$id в RESTful режиме: запись заменяется целиком,
+// колонки, которых нет в теле, получают значение по умолчанию
+func (exp *DbExplorer) ReplaceRecord(w http.ResponseWriter, r *http.Request, table *Table, rawId string) {
+	key, err := table.parseRecordKey(rawId, r.URL.Query())
+	if err != nil {
+		HandleError(w, err)
 		return
 	}
 
 	body, err := jsonBodyParser(r.Body)
-	r.Body.Close() // обязательно закрыть сразу, т.к повторой подключение к бд течет, хз почему
+	r.Body.Close()
 	if err != nil {
 		HandleError(w, err)
 		return
 	}
 
-	keys, values, err := exp.Validate(body, databaseName, tableName, r.Method)
+	keys, values, err := exp.Validate(body, table, payloadReplace)
 	if err != nil {
 		HandleError(w, err)
 		return
 	}
 
-	primaryKey, err := getPrimaryKey(exp.db, databaseName, tableName)
+	present := make(map[string]interface{}, len(keys))
+	for i, name := range keys {
+		present[name] = values[i]
+	}
+	// ключ из тела должен совпадать с ключом из пути
+	mismatch, err := keyMismatch(exp.db, table, key, present)
 	if err != nil {
-		HandleError(w, DbError{statusCode: http.StatusNotFound, err: errors.New("not found such table")})
+		HandleError(w, err)
 		return
 	}
-
-	values = append(values, id)
-	setValue := ""
-	for i := 0; i < len(keys); i++ {
-		setValue += keys[i] + " = ?"
-		if i != len(keys)-1 {
-			setValue += ","
-		}
+	if mismatch != "" {
+		str := fmt.Sprintf("field %s does not match id", mismatch)
+		HandleError(w, DbError{statusCode: http.StatusBadRequest, err: errors.New(str), code: "invalid_value", field: mismatch})
+		return
 	}
 
-	if Contains(keys, primaryKey) && IsRecordExist(exp.db, databaseName, tableName, primaryKey, id) {
-		HandleError(w, DbError{statusCode: http.StatusBadRequest, err: errors.New("field id have invalid type")})
-		return
+	setValues := make([]string, 0, len(table.Columns))
+	args := make([]interface{}, 0, len(table.Columns))
+	for _, column := range table.Columns {
+		value, exist := present[column.Name]
+		if table.IsPrimaryKey(column.Name) {
+			continue
+		}
+		if exist {
+			setValues = append(setValues, quoteIdent(column.Name)+" = ?")
+			args = append(args, value)
+		} else {
+			setValues = append(setValues, quoteIdent(column.Name)+" = DEFAULT")
+		}
 	}
 
-	query := fmt.Sprintf("UPDATE %s.%s SET %s WHERE %s = ?", databaseName, tableName, setValue, primaryKey)
-	result, err := exp.db.Exec(query, values...)
+	affected, err := updateRow(exp.db, table, key, setValues, args, table.preconditions(r))
 	if err != nil {
 		HandleError(w, err)
 		return
 	}
 
-	fmt.Println(result.LastInsertId())
 	data := make(map[string]int64, 1)
-	data["updated"] = 1
+	data["updated"] = affected
 	SendResponse(w, data)
 }
 
-func (exp *DbExplorer) Delete(w http.ResponseWriter, r *http.Request, tableName string, id int) {
-	databaseName, err := findDatabase(tableName, exp.db)
-	if err != nil || len(databaseName) == 0 {
-		HandleError(w, DbError{statusCode: http.StatusNotFound, err: errors.New("not found such table")})
-		return
+// keyMismatch - первая колонка ключа, значение которой в теле не совпадает с ключом записи.
+// Сравнивает mysql по правилам колонки: 1.50 и 1.5 в decimal равны, строки - по collation.
+// Записи нет - пусто, 404 вернёт сам UPDATE.
+func keyMismatch(conn dbConn, table *Table, key recordKey, body map[string]interface{}) (string, error) {
+	columns := make([]string, 0, len(table.PrimaryKey))
+	comparisons := make([]string, 0, len(table.PrimaryKey))
+	args := make([]interface{}, 0, len(table.PrimaryKey))
+	for _, name := range table.PrimaryKey {
+		if value, exist := body[name]; exist {
+			columns = append(columns, name)
+			comparisons = append(comparisons, quoteIdent(name)+" = ?")
+			args = append(args, value)
+		}
+	}
+	if len(columns) == 0 {
+		return "", nil
 	}
 
+	condition, keyArgs := table.keyCondition(key)
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s", strings.Join(comparisons, ", "), table.FullName(), condition)
+	matches := make([]sql.NullBool, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range matches {
+		dest[i] = &matches[i]
+	}
+	err := conn.QueryRow(query, append(args, keyArgs...)...).Scan(dest...)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", DbError{statusCode: http.StatusInternalServerError, err: err}
+	}
+	for i, match := range matches {
+		if !match.Bool {
+			return columns[i], nil
+		}
+	}
+	return "", nil
+}
 
+// updateRow - UPDATE одной записи по ключу, conditions - условия на её текущее состояние (If-Match, test).
+// mysql считает только изменённые строки, поэтому 0 проверяется отдельно:
+// нет записи - 404, не выполнено условие - его ошибка, иначе значения просто не изменились.
+func updateRow(conn dbConn, table *Table, key recordKey, setValues []string, args []interface{}, conditions []rowCondition) (int64, error) {
+	condition, keyArgs := table.keyCondition(key)
+	where, whereArgs := condition, append([]interface{}{}, keyArgs...)
+	for _, c := range conditions {
+		where += " AND " + c.sql
+		whereArgs = append(whereArgs, c.args...)
+	}
+
+	var affected int64
+	if len(setValues) > 0 { // в теле только неизвестные поля - обновлять нечего
+		query := fmt.Sprintf("UPDATE %s SET %s WHERE %s", table.FullName(), strings.Join(setValues, ", "), where)
+		result, err := conn.Exec(query, append(args, whereArgs...)...)
+		if err != nil {
+			return 0, err
+		}
+		if affected, err = result.RowsAffected(); err != nil {
+			return 0, DbError{statusCode: http.StatusInternalServerError, err: err}
+		}
+	}
+	if affected > 0 {
+		return affected, nil
+	}
+	if err := recordExists(conn, table, condition, keyArgs); err != nil {
+		return 0, err
+	}
+	for _, c := range conditions {
+		err := recordExists(conn, table, condition+" AND "+c.sql, append(append([]interface{}{}, keyArgs...), c.args...))
+		if e, ok := err.(DbError); ok && e.statusCode == http.StatusNotFound {
+			return 0, c.err
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return 0, nil
+}
 
-	primaryKey, err := getPrimaryKey(exp.db, databaseName, tableName)
+// recordExists возвращает 404, если записи с таким ключом нет
+func recordExists(conn dbConn, table *Table, condition string, args []interface{}) error {
+	var found int
+	query := fmt.Sprintf("SELECT 1 FROM %s WHERE %s LIMIT 1", table.FullName(), condition)
+	err := conn.QueryRow(query, args...).Scan(&found)
+	if err == sql.ErrNoRows {
+		return DbError{statusCode: http.StatusNotFound, err: errors.New("record not found")}
+	}
 	if err != nil {
-		HandleError(w, DbError{statusCode: http.StatusNotFound, err: errors.New("not found primary key")})
-		return
+		return DbError{statusCode: http.StatusInternalServerError, err: err}
 	}
-	query := fmt.Sprintf("DELETE FROM %s.%s WHERE %s = ?;", databaseName, tableName, primaryKey)
-	result, err := exp.db.Exec(query, id)
+	return nil
+}
+
+func (exp *DbExplorer) Delete(w http.ResponseWriter, r *http.Request, table *Table, rawId string) {
+	key, err := table.parseRecordKey(rawId, r.URL.Query())
 	if err != nil {
-		HandleError(w, DbError{statusCode: http.StatusInternalServerError, err: err})
+		HandleError(w, err)
 		return
 	}
-	affected, err := result.RowsAffected()
+
+	affected, err := deleteRow(exp.db, table, key, table.ifMatch(r))
 	if err != nil {
-		HandleError(w, DbError{statusCode: http.StatusInternalServerError, err: err})
+		HandleError(w, err)
 		return
 	}
 	data := make(map[string]int64, 1)
@@ -281,63 +594,88 @@ func (exp *DbExplorer) Delete(w http.ResponseWriter, r *http.Request, tableName
 	SendResponse(w, data)
 }
 
-func (exp *DbExplorer) handleGET(w http.ResponseWriter, r *http.Request, segments []string) {
-	if r.URL.Path == "/" {
-		exp.AllTables(w, r)
-	} else {
-		tableName := segments[0]
-		switch len(segments) {
-		case 1:
-			exp.List(w, r, tableName)
-		case 2:
-			id, err := strconv.Atoi(segments[1])
-			if err != nil {
-				HandleError(w, DbError{statusCode: http.StatusInternalServerError, err: err})
-				return
-			}
-			exp.RecordById(w, r, tableName, id)
-		default:
-			HandleError(w, DbError{statusCode: http.StatusNotFound, err: errors.New("unknown method")})
-		}
+// deleteRow - DELETE одной записи по ключу, ifMatch - необязательное условие на её версию
+func deleteRow(conn dbConn, table *Table, key recordKey, ifMatch *rowCondition) (int64, error) {
+	condition, args := table.keyCondition(key)
+	if ifMatch != nil {
+		condition += " AND " + ifMatch.sql
+		args = append(args, ifMatch.args...)
+	}
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s;", table.FullName(), condition)
+	result, err := conn.Exec(query, args...)
+	if err != nil {
+		return 0, DbError{statusCode: http.StatusInternalServerError, err: err}
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, DbError{statusCode: http.StatusInternalServerError, err: err}
 	}
+	if affected == 0 && ifMatch != nil { // записи нет или её версия другая
+		return 0, ifMatch.err
+	}
+	return affected, nil
 }
 
-func (exp *DbExplorer) handlePUT(w http.ResponseWriter, r *http.Request, segments []string) {
-	tableName := segments[0]
-	switch len(segments) {
-	case 1:
-		exp.CreateRecord(w, r, tableName)
-	default:
+// recordSegment достаёт ключ записи из остатка пути после таблицы: /$id или ?pk.$column=...
+func recordSegment(r *http.Request, segments []string) (string, bool) {
+	switch {
+	case len(segments) == 1:
+		return segments[0], true
+	case len(segments) == 0 && hasKeyParams(r.URL.Query()):
+		return "", true
+	}
+	return "", false
+}
+
+func (exp *DbExplorer) handleGET(w http.ResponseWriter, r *http.Request, table *Table, segments []string) {
+	if len(segments) == 1 && segments[0] == schemaSegment {
+		exp.TableSchema(w, r, table)
+	} else if len(segments) == 2 && segments[0] == schemaSegment && isPayloadKind(segments[1]) {
+		exp.PayloadSchema(w, r, table, segments[1])
+	} else if rawId, ok := recordSegment(r, segments); ok {
+		exp.RecordById(w, r, table, rawId)
+	} else if len(segments) == 0 {
+		exp.List(w, r, table)
+	} else {
 		HandleError(w, DbError{statusCode: http.StatusNotFound, err: errors.New("unknown method")})
 	}
 }
 
-func (exp *DbExplorer) handlePOST(w http.ResponseWriter, r *http.Request, segments []string) {
-	tableName := segments[0]
+func (exp *DbExplorer) handleCreate(w http.ResponseWriter, r *http.Request, table *Table, segments []string) {
 	switch len(segments) {
-	case 2:
-		id, err := strconv.Atoi(segments[1])
-		if err != nil {
-			HandleError(w, DbError{statusCode: http.StatusInternalServerError, err: err})
-			return
+	case 0:
+		if isBulk(r) {
+			exp.BulkCreate(w, r, table)
+		} else {
+			exp.CreateRecord(w, r, table)
 		}
-		exp.UpdateRecord(w, r, tableName, id)
 	default:
 		HandleError(w, DbError{statusCode: http.StatusNotFound, err: errors.New("unknown method")})
 	}
 }
 
-func (exp *DbExplorer) handleDELETE(w http.ResponseWriter, r *http.Request, segments []string) {
-	tableName := segments[0]
-	switch len(segments) {
-	case 2:
-		id, err := strconv.Atoi(segments[1])
-		if err != nil {
-			HandleError(w, DbError{statusCode: http.StatusInternalServerError, err: err})
-			return
-		}
-		exp.Delete(w, r, tableName, id)
-	default:
+func (exp *DbExplorer) handleUpdate(w http.ResponseWriter, r *http.Request, table *Table, segments []string) {
+	if rawId, ok := recordSegment(r, segments); ok {
+		exp.UpdateRecord(w, r, table, rawId)
+	} else {
+		HandleError(w, DbError{statusCode: http.StatusNotFound, err: errors.New("unknown method")})
+	}
+}
+
+func (exp *DbExplorer) handleReplace(w http.ResponseWriter, r *http.Request, table *Table, segments []string) {
+	if rawId, ok := recordSegment(r, segments); ok {
+		exp.ReplaceRecord(w, r, table, rawId)
+	} else {
+		HandleError(w, DbError{statusCode: http.StatusNotFound, err: errors.New("unknown method")})
+	}
+}
+
+func (exp *DbExplorer) handleDELETE(w http.ResponseWriter, r *http.Request, table *Table, segments []string) {
+	if rawId, ok := recordSegment(r, segments); ok {
+		exp.Delete(w, r, table, rawId)
+	} else if len(segments) == 0 {
+		exp.DeleteWhere(w, r, table)
+	} else {
 		HandleError(w, DbError{statusCode: http.StatusNotFound, err: errors.New("unknown method")})
 	}
 }
@@ -349,17 +687,80 @@ func (exp *DbExplorer) listFunc(w http.ResponseWriter, r *http.Request) {
 	// вариант использовать  router map[string]func(http.ResponseWriter, *http.Request)
 	// и инициализировать маршруты по следующему виду exp.router["/items/{id}"] = exp.GetItemById
 	// затем каждый входящий url приводить к виду, который лежит в map
-	switch r.Method {
-	case "GET":
-		exp.handleGET(w, r, segments)
-	case "PUT":
-		exp.handlePUT(w, r, segments)
-	case "POST":
-		exp.handlePOST(w, r, segments)
-	case "DELETE":
-		exp.handleDELETE(w, r, segments)
-	default:
+	handler := exp.tableHandlers()[r.Method]
+
+	if path == "" {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		exp.AllTables(w, r)
+		return
+	}
+	// /$database/$table/... или короткая форма /$table/..., если имя таблицы однозначно
+	table, rest, err := exp.getSchema().ResolveTable(segments)
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+	if allowed := exp.allowedMethods(r, rest); len(allowed) > 0 && !Contains(allowed, r.Method) {
+		methodNotAllowed(w, allowed...)
+		return
+	}
+	if handler == nil {
 		HandleError(w, DbError{statusCode: http.StatusNotFound, err: errors.New("unknown method")})
+		return
+	}
+	handler(w, r, table, rest)
+}
+
+type tableHandler func(http.ResponseWriter, *http.Request, *Table, []string)
+
+// tableHandlers - обработчики по http-методу для выбранного режима маршрутизации
+func (exp *DbExplorer) tableHandlers() map[string]tableHandler {
+	handlers := map[string]tableHandler{
+		http.MethodGet:    exp.handleGET,
+		http.MethodDelete: exp.handleDELETE,
 	}
+	if exp.routing == RESTfulRouting {
+		handlers[http.MethodPost] = exp.handleCreate
+		handlers[http.MethodPut] = exp.handleReplace
+		handlers[http.MethodPatch] = exp.handlePatch
+	} else {
+		handlers[http.MethodPut] = exp.handleCreate
+		handlers[http.MethodPost] = exp.handleUpdate
+		handlers[http.MethodPatch] = exp.handlePatch
+	}
+	return handlers
+}
+
+// writeMethods - методы создания записи и изменения существующей в текущем режиме
+func (exp *DbExplorer) writeMethods() (string, []string) {
+	if exp.routing == RESTfulRouting {
+		return http.MethodPost, []string{http.MethodPut, http.MethodPatch}
+	}
+	return http.MethodPut, []string{http.MethodPost, http.MethodPatch}
+}
+
+// allowedMethods - методы ресурса по остатку пути после таблицы, nil - такого ресурса нет
+func (exp *DbExplorer) allowedMethods(r *http.Request, segments []string) []string {
+	create, update := exp.writeMethods()
+	switch {
+	case len(segments) > 0 && segments[0] == schemaSegment:
+		return []string{http.MethodGet}
+	case len(segments) == 0 && hasKeyParams(r.URL.Query()):
+		// запись по ?pk.$column - тот же ресурс, что /$table/$id, создавать по нему нельзя
+		return append(append([]string{http.MethodGet}, update...), http.MethodDelete)
+	case len(segments) == 0:
+		return []string{http.MethodGet, create, http.MethodPatch, http.MethodDelete}
+	case len(segments) == 1:
+		return append(append([]string{http.MethodGet}, update...), http.MethodDelete)
+	}
+	return nil
+}
 
+// methodNotAllowed - 405 с заголовком Allow
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	HandleError(w, DbError{statusCode: http.StatusMethodNotAllowed, err: errors.New("method not allowed")})
 }
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Ошибка по умолчанию отдаётся как раньше: {"error": "текст"}.
+// Клиент, приславший Accept: application/problem+json, получает полную модель:
+// код, сообщение, поле, список ошибок по полям и id запроса (RFC 7807).
+
+const (
+	requestIDHeader    = "X-Request-Id"
+	problemContentType = "application/problem+json"
+)
+
+// problem - тело ответа application/problem+json
+type problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Code      string       `json:"code"`
+	Detail    string       `json:"detail"`
+	Field     string       `json:"field,omitempty"`
+	Details   []fieldError `json:"details,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+}
+
+// errorWriter запоминает id запроса и то, в каком виде клиент ждёт ошибку
+type errorWriter struct {
+	http.ResponseWriter
+	requestID string
+	problem   bool
+}
+
+func newErrorWriter(w http.ResponseWriter, r *http.Request) *errorWriter {
+	requestID := r.Header.Get(requestIDHeader)
+	if requestID == "" || len(requestID) > 128 {
+		buf := make([]byte, 8)
+		rand.Read(buf)
+		requestID = hex.EncodeToString(buf)
+	}
+	w.Header().Set(requestIDHeader, requestID)
+	return &errorWriter{
+		ResponseWriter: w,
+		requestID:      requestID,
+		problem:        strings.Contains(r.Header.Get("Accept"), problemContentType),
+	}
+}
+
+// validationError собирает ошибки по полям в одну 400 с перечислением всех полей
+func validationError(errs []fieldError) DbError {
+	messages := make([]string, 0, len(errs))
+	for _, e := range errs {
+		messages = append(messages, e.Message)
+	}
+	res := DbError{
+		statusCode: http.StatusBadRequest,
+		err:        errors.New(strings.Join(messages, "; ")),
+		code:       "validation_failed",
+		details:    errs,
+	}
+	if len(errs) == 1 {
+		res.field = errs[0].Field
+	}
+	return res
+}
+
+// toDbError приводит любую ошибку к DbError. Ошибки mysql, вызванные данными
+// клиента (дубликат ключа, внешний ключ, длина), становятся 409/422 вместо 500.
+func toDbError(err error) DbError {
+	e, ok := err.(DbError)
+	if ok && e.statusCode != http.StatusInternalServerError {
+		return e
+	}
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		if !ok {
+			e = DbError{statusCode: http.StatusInternalServerError, err: err}
+		}
+		return e
+	}
+	res := DbError{statusCode: http.StatusUnprocessableEntity, err: errors.New(mysqlErr.Message)}
+	switch mysqlErr.Number {
+	case 1062: // ER_DUP_ENTRY
+		res.statusCode, res.code = http.StatusConflict, "duplicate_key"
+	case 1451: // ER_ROW_IS_REFERENCED_2
+		res.statusCode, res.code = http.StatusConflict, "row_referenced"
+	case 1452: // ER_NO_REFERENCED_ROW_2
+		res.code = "foreign_key_violation"
+	case 1406: // ER_DATA_TOO_LONG
+		res.code, res.field = "too_long", columnFromMessage(mysqlErr.Message)
+	case 1048, 1364: // ER_BAD_NULL_ERROR, ER_NO_DEFAULT_FOR_FIELD
+		res.code, res.field = "required", columnFromMessage(mysqlErr.Message)
+	case 1264: // ER_WARN_DATA_OUT_OF_RANGE
+		res.code, res.field = "out_of_range", columnFromMessage(mysqlErr.Message)
+	default:
+		return DbError{statusCode: http.StatusInternalServerError, err: err}
+	}
+	return res
+}
+
+// columnFromMessage достаёт имя колонки из текста ошибки mysql: "... column 'title' ..."
+func columnFromMessage(message string) string {
+	match := regexp.MustCompile(`(?i)(?:column|field) '([^']+)'`).FindStringSubmatch(message)
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+// errorCode - код по умолчанию из статуса: 404 -> not_found
+func errorCode(status int) string {
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
+
+func (e DbError) problem(requestID string) problem {
+	code := e.code
+	if code == "" {
+		code = errorCode(e.statusCode)
+	}
+	return problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(e.statusCode),
+		Status:    e.statusCode,
+		Code:      code,
+		Detail:    e.Error(),
+		Field:     e.field,
+		Details:   e.details,
+		RequestID: requestID,
+	}
+}
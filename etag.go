@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ETag записи - хеш значений всех её колонок. Считается в mysql, поэтому
+// If-Match проверяется в том же UPDATE/DELETE, без гонки между чтением и записью.
+// ETag списка - хеш тела ответа, нужен только для If-None-Match.
+
+const (
+	etagColumn = "__etag"
+	// listETagField - ETag строки в записях списка при ?etag=1, его можно сразу отправить в If-Match
+	listETagField = "_etag"
+)
+
+// rowCondition - условие на текущее состояние записи и ошибка, если оно не выполнено
+type rowCondition struct {
+	sql  string
+	args []interface{}
+	err  DbError
+}
+
+// rowVersion - sql-выражение версии строки
+func (t *Table) rowVersion() string {
+	return "SHA1(JSON_ARRAY(" + strings.Join(quoteIdents(t.ColumnNames()), ", ") + "))"
+}
+
+func quoteETag(version string) string {
+	return `"` + version + `"`
+}
+
+// takeRowETag достаёт версию строки, выбранную как __etag, и убирает её из записи
+func takeRowETag(record map[string]interface{}) string {
+	etag := quoteETag(fmt.Sprint(record[etagColumn]))
+	delete(record, etagColumn)
+	return etag
+}
+
+// parseETags разбирает If-Match / If-None-Match: список тегов или "*".
+// weak - вернуть и слабые теги W/"...", для If-Match они не подходят.
+func parseETags(header string, weak bool) ([]string, bool) {
+	tags := make([]string, 0)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return nil, true
+		}
+		if strings.HasPrefix(tag, "W/") {
+			if !weak {
+				continue
+			}
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if len(tag) >= 2 && strings.HasPrefix(tag, `"`) && strings.HasSuffix(tag, `"`) {
+			tags = append(tags, strings.Trim(tag, `"`))
+		}
+	}
+	return tags, false
+}
+
+// ifMatch - условие из заголовка If-Match, nil - заголовка нет
+func (t *Table) ifMatch(r *http.Request) *rowCondition {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return nil
+	}
+	failed := DbError{statusCode: http.StatusPreconditionFailed, err: errors.New("record was modified"), code: "precondition_failed"}
+	tags, any := parseETags(header, false)
+	if any {
+		return &rowCondition{sql: "1 = 1", err: failed}
+	}
+	if len(tags) == 0 {
+		return &rowCondition{sql: "1 = 0", err: failed}
+	}
+	args := make([]interface{}, 0, len(tags))
+	for _, tag := range tags {
+		args = append(args, tag)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(tags)), ", ")
+	return &rowCondition{sql: t.rowVersion() + " IN (" + placeholders + ")", args: args, err: failed}
+}
+
+// preconditions - условия для изменения записи: If-Match и дополнительные
+func (t *Table) preconditions(r *http.Request, extra ...rowCondition) []rowCondition {
+	conditions := make([]rowCondition, 0, len(extra)+1)
+	if condition := t.ifMatch(r); condition != nil {
+		conditions = append(conditions, *condition)
+	}
+	return append(conditions, extra...)
+}
+
+// notModified ставит ETag и отвечает 304, если он совпал с If-None-Match
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	tags, any := parseETags(header, true)
+	if any || Contains(tags, strings.Trim(etag, `"`)) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// responseETag - ETag ответа, который нельзя привязать к одной строке
+func responseETag(data interface{}) string {
+	body, _ := json.Marshal(data)
+	sum := sha1.Sum(body)
+	return quoteETag(hex.EncodeToString(sum[:]))
+}
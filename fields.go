@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// parseFields разбирает ?fields=title,updated. Первичный ключ добавляется всегда,
+// чтобы запись можно было адресовать. nil - нужны все колонки.
+func (t *Table) parseFields(raw string) ([]string, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	fields := make([]string, 0)
+	fields = append(fields, t.PrimaryKey...)
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		if _, ok := t.Column(name); !ok {
+			str := fmt.Sprintf("unknown field %s", name)
+			return nil, DbError{statusCode: http.StatusBadRequest, err: errors.New(str)}
+		}
+		if !Contains(fields, name) {
+			fields = append(fields, name)
+		}
+	}
+	return fields, nil
+}
+
+// selectList - список колонок для SELECT, extra добавляются если их нет в fields
+func selectList(fields []string, extra ...string) string {
+	if fields == nil {
+		return "*"
+	}
+	columns := append([]string{}, fields...)
+	for _, name := range extra {
+		if !Contains(columns, name) {
+			columns = append(columns, name)
+		}
+	}
+	return strings.Join(quoteIdents(columns), ", ")
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// префикс параметров фильтра: ?filter.email.like=%25@corp.com&filter.updated.null=true
+const filterParamPrefix = "filter."
+
+type filterCondition struct {
+	column   string
+	operator string
+	args     []interface{}
+}
+
+// Filter - набор условий, объединённых через AND
+type Filter []filterCondition
+
+// parseFilter собирает условия из параметров filter.$column.$op.
+// Колонки проверяются по схеме таблицы, значения приводятся к типу колонки
+// и уходят в запрос только плейсхолдерами.
+func (t *Table) parseFilter(params url.Values) (Filter, error) {
+	names := make([]string, 0)
+	for name := range params {
+		if strings.HasPrefix(name, filterParamPrefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names) // чтобы текст запроса не зависел от порядка обхода map
+
+	filter := make(Filter, 0, len(names))
+	for _, name := range names {
+		spec := strings.TrimPrefix(name, filterParamPrefix)
+		dot := strings.LastIndex(spec, ".")
+		if dot <= 0 {
+			str := fmt.Sprintf("invalid filter %s, expected %s$column.$op", name, filterParamPrefix)
+			return nil, DbError{statusCode: http.StatusBadRequest, err: errors.New(str)}
+		}
+		columnName, operator := spec[:dot], spec[dot+1:]
+		column, ok := t.Column(columnName)
+		if !ok {
+			str := fmt.Sprintf("unknown filter column %s", columnName)
+			return nil, DbError{statusCode: http.StatusBadRequest, err: errors.New(str)}
+		}
+		for _, raw := range params[name] {
+			condition, err := newFilterCondition(column, operator, raw)
+			if err != nil {
+				return nil, err
+			}
+			filter = append(filter, condition)
+		}
+	}
+	return filter, nil
+}
+
+func newFilterCondition(column *Column, operator, raw string) (filterCondition, error) {
+	condition := filterCondition{column: column.Name, operator: operator}
+	invalidValue := func() (filterCondition, error) {
+		str := fmt.Sprintf("invalid value for filter %s.%s", column.Name, operator)
+		return filterCondition{}, DbError{statusCode: http.StatusBadRequest, err: errors.New(str)}
+	}
+
+	var parts []string
+	switch operator {
+	case "eq", "ne", "lt", "lte", "gt", "gte":
+		parts = []string{raw}
+	case "in":
+		parts = strings.Split(raw, ",")
+	case "between":
+		parts = strings.Split(raw, ",")
+		if len(parts) != 2 {
+			return invalidValue()
+		}
+	case "like":
+		// шаблон не приводим к типу колонки, mysql сравнивает как строку
+		condition.args = []interface{}{raw}
+		return condition, nil
+	case "null":
+		isNull, err := strconv.ParseBool(raw)
+		if err != nil {
+			return invalidValue()
+		}
+		if !isNull {
+			condition.operator = "notnull"
+		}
+		return condition, nil
+	default:
+		str := fmt.Sprintf("unknown filter operator %s", operator)
+		return filterCondition{}, DbError{statusCode: http.StatusBadRequest, err: errors.New(str)}
+	}
+
+	for _, part := range parts {
+		value, err := parseParamValue(column, part)
+		if err != nil {
+			return invalidValue()
+		}
+		condition.args = append(condition.args, value)
+	}
+	return condition, nil
+}
+
+func (c filterCondition) sql() string {
+	column := quoteIdent(c.column)
+	switch c.operator {
+	case "eq":
+		return column + " = ?"
+	case "ne":
+		return column + " <> ?"
+	case "lt":
+		return column + " < ?"
+	case "lte":
+		return column + " <= ?"
+	case "gt":
+		return column + " > ?"
+	case "gte":
+		return column + " >= ?"
+	case "in":
+		return column + " IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(c.args)), ", ") + ")"
+	case "between":
+		return column + " BETWEEN ? AND ?"
+	case "like":
+		return column + " LIKE ?"
+	case "null":
+		return column + " IS NULL"
+	case "notnull":
+		return column + " IS NOT NULL"
+	}
+	return ""
+}
+
+// where - условие для WHERE и аргументы к нему, пустая строка если фильтра нет
+func (f Filter) where() (string, []interface{}) {
+	conditions := make([]string, 0, len(f))
+	args := make([]interface{}, 0)
+	for _, condition := range f {
+		conditions = append(conditions, condition.sql())
+		args = append(args, condition.args...)
+	}
+	return strings.Join(conditions, " AND "), args
+}
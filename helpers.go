@@ -3,16 +3,18 @@ package main
 import (
 	"database/sql"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"net/http"
-	"reflect"
 	"strconv"
 )
 
 type DbError struct {
 	statusCode int
 	err        error
+
+	code    string       // машинный код, по умолчанию выводится из статуса
+	field   string       // поле, к которому относится ошибка
+	details []fieldError // ошибки по отдельным полям
 }
 
 func (e DbError) Error() string {
@@ -23,6 +25,10 @@ func (e DbError) Status() int {
 	return e.statusCode
 }
 
+func (e DbError) Unwrap() error {
+	return e.err
+}
+
 func Contains[T comparable](slice []T, value T) bool {
 	for _, v := range slice {
 		if v == value {
@@ -32,6 +38,20 @@ func Contains[T comparable](slice []T, value T) bool {
 	return false
 }
 
+func IndexOf[T comparable](slice []T, value T) int {
+	for i, v := range slice {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
+
+func retrieveFlag(paramStr string) bool {
+	res, err := strconv.ParseBool(paramStr)
+	return err == nil && res
+}
+
 func retrieveParam(paramStr string, defaultValue int) int {
 	var res int
 	if paramStr == "" {
@@ -46,173 +66,69 @@ func retrieveParam(paramStr string, defaultValue int) int {
 	return res
 }
 
-func getTables(db *sql.DB) (map[string][]string, error) {
-
-	rows, err := db.Query("SHOW TABLES")
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	res := make(map[string][]string)
-	for rows.Next() {
-		var tableName string
-		rows.Scan(&tableName)
-		tables := res["tables"]
-		tables = append(tables, tableName)
-		res["tables"] = tables
-	}
-	return res, nil
-}
-
-// лучше хранить в каком нибудь кэше или неумираемой переменной.
-func getDatabases(db *sql.DB) (map[string]map[string]struct{}, error) {
-	// получить список таблиц из *всех баз данных*
-	rows, err := db.Query(
-		"SELECT TABLE_SCHEMA, TABLE_NAME " +
-			"FROM information_schema.tables " +
-			"WHERE TABLE_TYPE = 'BASE TABLE'" +
-			"AND table_schema NOT IN ('mysql', 'information_schema', 'performance_schema', 'sys')")
-
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	databases := make(map[string]map[string]struct{}, 0)
-	for rows.Next() {
-		var tableSchema, tableName string
-		err := rows.Scan(&tableSchema, &tableName)
-		if err != nil {
-			rows.Close()
-			return nil, err
-		}
-		tables := databases[tableSchema]
-		if tables == nil {
-			tables = make(map[string]struct{})
-		}
-		tables[tableName] = struct{}{}
-		databases[tableSchema] = tables
-	}
-	if err = rows.Err(); err != nil {
-		return databases, err
-	}
-	return databases, nil
-}
-
-func findDatabase(tableName string, db *sql.DB) (string, error) {
-	var databaseName string
-
-	databases, err := getDatabases(db)
-	if err != nil {
-		return "", err
-	}
-	for database, tables := range databases {
-		if _, ok := tables[tableName]; ok {
-			databaseName = database
-			break
-		}
-	}
-	if len(databaseName) == 0 {
-		err := DbError{err: errors.New("unknown table"), statusCode: http.StatusNotFound}
-		return "", err
-	}
-	return databaseName, nil
-	//return "golang", nil
-}
-
-func getPrimaryKey(db *sql.DB, databaseName, tableName string) (string, error) {
-	query := fmt.Sprintf("SELECT * FROM %s.%s LIMIT 1", databaseName, tableName)
-	rows, err := db.Query(query)
-	if err != nil {
-		return "", err
-	}
-	defer rows.Close()
-	columns, err := rows.Columns()
-	if err != nil {
-		return "", err
-	}
-	return columns[0], nil
-}
-
-func isPrimaryKey(db *sql.DB, databaseName, tableName string, key string) bool {
-	primaryKey, err := getPrimaryKey(db, databaseName, tableName)
-	if err != nil || key != primaryKey {
-		return false
-	}
-	return true
-}
-
-type TypeInfo struct {
-	Type       reflect.Type
-	IsNullable bool
-}
-
-func getReference(db *sql.DB, databaseName, tableName string) (map[string]TypeInfo, error) {
-	query := "SELECT COLUMN_NAME, DATA_TYPE, IS_NULLABLE FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?;"
-	rows, err := db.Query(query, databaseName, tableName)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	types := make(map[string]TypeInfo) // информация о типах взятая из БД
-	for rows.Next() {
-		var Field, Type string
-		var IsNullable string
-		if err := rows.Scan(&Field, &Type, &IsNullable); err != nil {
-			return nil, err
-		}
-		types[Field] = TypeInfo{toGoNativeType(Type), IsNullable == "YES"}
-	}
-	return types, nil
-}
-
-func isIdAutoIncrement(db *sql.DB, id string, databaseName, tableName string) bool {
-	query := "SELECT COLUMN_NAME FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND EXTRA LIKE ?"
-	row := db.QueryRow(query, databaseName, tableName, "%auto_increment%")
-	err := row.Err()
-	if err != nil || row == nil {
-		return false
-	}
-	var v string
-	row.Scan(&v)
-	return v == id
-}
-
 func HandleError(w http.ResponseWriter, err error) {
-	w.Header().Set("Content-type", "application/json")
-	if e, ok := err.(DbError); ok {
+	e := toDbError(err)
+	if ew, ok := w.(*errorWriter); ok && ew.problem {
+		w.Header().Set("Content-type", problemContentType)
 		w.WriteHeader(e.statusCode)
-	} else {
-		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(e.problem(ew.requestID))
+		return
 	}
 
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(e.statusCode)
 	json.NewEncoder(w).Encode(map[string]string{
-		"error": err.Error(),
+		"error": e.Error(),
 	})
 }
 
-func printAllRecords(db *sql.DB, databaseName, tableName string) {
-	query := fmt.Sprintf("SELECT * FROM %s.%s;", databaseName, tableName)
+func printAllRecords(db *sql.DB, table *Table) {
+	query := fmt.Sprintf("SELECT * FROM %s;", table.FullName())
 	rows, _ := db.Query(query)
 	defer rows.Close()
-	records, _ := Pack(rows)
+	records, _ := Pack(rows, table)
 	fmt.Println(records)
 }
 
-func IsRecordExist(db *sql.DB, databaseName, tableName, primaryKey string, id int) bool {
-	query := fmt.Sprintf("SELECT * FROM %s.%s WHERE %s = ?;", databaseName, tableName, primaryKey)
+// ResultColumn - метаданные колонки результата запроса
+type ResultColumn struct {
+	Name     string     `json:"name"`
+	Type     string     `json:"type"` // DatabaseTypeName
+	Nullable bool       `json:"nullable"`
+	Kind     columnKind `json:"kind"`
+
+	column *Column
+}
 
-	row := db.QueryRow(query, id)
-	if row != nil {
-		return true
+// PackColumns описывает колонки результата по rows.ColumnTypes.
+// Колонки таблицы берём из схемы - там видно tinyint(1) и binary(16), драйвер длину не отдаёт.
+func PackColumns(rows *sql.Rows, table *Table) ([]*ResultColumn, error) {
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
 	}
-	return false
+	res := make([]*ResultColumn, 0, len(columnTypes))
+	for _, columnType := range columnTypes {
+		nullable, _ := columnType.Nullable()
+		column, ok := table.Column(columnType.Name())
+		if !ok {
+			column = &Column{Name: columnType.Name(), IsNullable: nullable, Kind: kindFromColumnType(columnType)}
+		}
+		res = append(res, &ResultColumn{
+			Name:     columnType.Name(),
+			Type:     columnType.DatabaseTypeName(),
+			Nullable: nullable,
+			Kind:     column.Kind,
+			column:   column,
+		})
+	}
+	return res, nil
 }
 
-func Pack(rows *sql.Rows) ([]map[string]interface{}, error) {
+func Pack(rows *sql.Rows, table *Table) ([]map[string]interface{}, error) {
 	defer rows.Close()
 	res := make([]map[string]interface{}, 0)
-	columns, err := rows.Columns()
+	columns, err := PackColumns(rows, table)
 	if err != nil {
 		return nil, err
 	}
@@ -227,28 +143,14 @@ func Pack(rows *sql.Rows) ([]map[string]interface{}, error) {
 			return nil, err
 		}
 		data := make(map[string]interface{}, 0)
-		for i := 0; i < len(columns); i++ {
+		for i, column := range columns {
 			v := *(values[i].(*interface{}))
-			if b, ok := v.([]byte); ok {
-				data[columns[i]] = string(b)
-			} else {
-				data[columns[i]] = v
-			}
+			data[column.Name] = column.column.fromDbValue(v)
 		}
 		res = append(res, data)
 	}
-	if len(res) == 0 {
-		err := DbError{err: errors.New("record not found"), statusCode: http.StatusNotFound}
+	if err = rows.Err(); err != nil {
 		return nil, err
 	}
 	return res, nil
 }
-
-func toGoNativeType(Type string) reflect.Type {
-	if Type == "varchar" || Type == "text" {
-		return reflect.TypeOf("")
-	} else if Type == "int" {
-		return reflect.TypeOf(int64(0))
-	}
-	return nil
-}
@@ -0,0 +1,61 @@
+package main
+
+import "net/http"
+
+// сегмент пути для описания таблицы: GET /$table/_schema
+const schemaSegment = "_schema"
+
+type columnSchema struct {
+	Name          string     `json:"name"`
+	Type          string     `json:"type"` // COLUMN_TYPE как в mysql
+	Kind          columnKind `json:"kind"`
+	Nullable      bool       `json:"nullable"`
+	Default       *string    `json:"default"`
+	AutoIncrement bool       `json:"auto_increment"`
+	Key           string     `json:"key,omitempty"`
+	MaxLength     *int64     `json:"max_length,omitempty"`
+}
+
+type tableSchema struct {
+	Database    string         `json:"database"`
+	Name        string         `json:"name"`
+	PrimaryKey  []string       `json:"primary_key"`
+	Columns     []columnSchema `json:"columns"`
+	Indexes     []*Index       `json:"indexes"`
+	ForeignKeys []*ForeignKey  `json:"foreign_keys"`
+}
+
+func describeTable(table *Table) tableSchema {
+	res := tableSchema{
+		Database:    table.Database,
+		Name:        table.Name,
+		PrimaryKey:  append([]string{}, table.PrimaryKey...),
+		Columns:     make([]columnSchema, 0, len(table.Columns)),
+		Indexes:     append([]*Index{}, table.Indexes...),
+		ForeignKeys: append([]*ForeignKey{}, table.ForeignKeys...),
+	}
+	for _, column := range table.Columns {
+		item := columnSchema{
+			Name:          column.Name,
+			Type:          column.ColumnType,
+			Kind:          column.Kind,
+			Nullable:      column.IsNullable,
+			AutoIncrement: column.AutoIncrement,
+			Key:           column.Key,
+		}
+		if column.Default.Valid {
+			item.Default = &column.Default.String
+		}
+		if column.MaxLength.Valid {
+			item.MaxLength = &column.MaxLength.Int64
+		}
+		res.Columns = append(res.Columns, item)
+	}
+	return res
+}
+
+func (exp *DbExplorer) TableSchema(w http.ResponseWriter, r *http.Request, table *Table) {
+	data := make(map[string]interface{})
+	data["schema"] = describeTable(table)
+	SendResponse(w, data)
+}
@@ -2,17 +2,21 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
+	"strconv"
 )
 
+// convertNumber - целые в int64/uint64, остальное остаётся json.Number:
+// через float64 decimal потерял бы точность, к типу колонки приводит toDbValue
 func convertNumber(num json.Number) interface{} {
 	if i, err := num.Int64(); err == nil {
 		return i // сохранить как int64
-	} else if f, err := num.Float64(); err == nil {
-		return f
+	} else if u, err := strconv.ParseUint(num.String(), 10, 64); err == nil {
+		return u // unsigned bigint больше MaxInt64
 	}
-	return nil
+	return num
 }
 
 func convertNumbers(src map[string]interface{}) map[string]interface{} {
@@ -38,12 +42,13 @@ func jsonBodyParser(Body io.ReadCloser) (map[string]interface{}, error) {
 	err := decoder.Decode(&data)
 
 	if err != nil {
-		return nil, DbError{statusCode: http.StatusInternalServerError, err: err}
+		// битый json, пустое тело или не объект - ошибка клиента
+		return nil, DbError{statusCode: http.StatusBadRequest, err: errors.New("invalid json body")}
 	}
 
 	_, err = io.Copy(io.Discard, decoder.Buffered())
 	if err != nil {
-		return nil, DbError{statusCode: http.StatusInternalServerError, err: err}
+		return nil, DbError{statusCode: http.StatusBadRequest, err: err}
 	}
 
 	res := convertNumbers(data)
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// JSON Schema (draft 2020-12) для тел запросов на вставку и обновление.
+// Validate проверяет тело по этой же схеме, поэтому клиент, проверивший
+// payload по /$table/_schema/insert, получит от сервера тот же результат.
+
+const (
+	jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+	decimalPattern    = `^[+-]?([0-9]+(\.[0-9]*)?|\.[0-9]+)([eE][+-]?[0-9]+)?$`
+
+	payloadInsert  = "insert"
+	payloadUpdate  = "update"  // частичное обновление, ключ менять нельзя
+	payloadReplace = "replace" // PUT /$table/$id в RESTful режиме: отсутствующие поля получают default
+)
+
+func isPayloadKind(name string) bool {
+	return name == payloadInsert || name == payloadUpdate || name == payloadReplace
+}
+
+// columnJSONSchema - схема значения колонки в теле запроса
+func columnJSONSchema(column *Column) object {
+	res := object{}
+	var types []string
+	switch column.Kind {
+	case kindString, kindTime:
+		types = []string{"string"}
+	case kindEnum:
+		types = []string{"string"}
+		members := make([]interface{}, 0)
+		for _, member := range enumMembers(column.ColumnType) {
+			members = append(members, member)
+		}
+		if column.IsNullable {
+			members = append(members, nil) // иначе null не пройдёт enum
+		}
+		res["enum"] = members
+	case kindSet:
+		// строка "a,b" или массив ["a", "b"]
+		types = []string{"string", "array"}
+		members := make([]interface{}, 0)
+		quoted := make([]string, 0)
+		for _, member := range enumMembers(column.ColumnType) {
+			members = append(members, member)
+			quoted = append(quoted, regexp.QuoteMeta(member))
+		}
+		res["items"] = object{"type": "string", "enum": members}
+		member := "(" + strings.Join(quoted, "|") + ")"
+		res["pattern"] = "^(" + member + "(," + member + ")*)?$"
+	case kindInteger, kindUnsigned, kindBit:
+		types = []string{"integer"}
+		res["minimum"], res["maximum"] = integerRange(column)
+	case kindYear:
+		types = []string{"integer"}
+		res["minimum"], res["maximum"] = 0, 2155 // 0 или 1901..2155, промежуток отсекает mysql
+	case kindBool:
+		types = []string{"boolean", "integer"}
+		res["minimum"], res["maximum"] = integerRange(column)
+	case kindDecimal:
+		// строкой можно передать точное значение
+		types = []string{"number", "string"}
+		res["pattern"] = decimalPattern
+	case kindFloat:
+		types = []string{"number"}
+	case kindDate:
+		types = []string{"string"}
+		res["format"] = "date"
+	case kindDateTime:
+		types = []string{"string"}
+		res["format"] = "date-time"
+	case kindJSON:
+		if column.IsNullable {
+			return res // любое значение, null пишется как NULL
+		}
+		types = []string{"object", "array", "string", "number", "boolean"}
+	case kindBinary:
+		types = []string{"string"}
+		res["contentEncoding"] = "base64"
+	case kindUUID:
+		types = []string{"string"}
+		res["format"] = "uuid"
+	default:
+		return object{"not": object{}} // geometry и прочее не поддерживаем
+	}
+	if column.IsNullable {
+		types = append(types, "null")
+	}
+	if len(types) == 1 {
+		res["type"] = types[0]
+	} else {
+		res["type"] = types
+	}
+	if column.Kind == kindString && column.MaxLength.Valid {
+		res["maxLength"] = column.MaxLength.Int64
+	}
+	if value, ok := columnDefault(column); ok && len(validateValue(res, value, nil)) == 0 {
+		res["default"] = value
+	}
+	return res
+}
+
+// integerRange - допустимые значения целой колонки по её размеру и знаку
+func integerRange(column *Column) (interface{}, interface{}) {
+	if column.Kind == kindBit {
+		bits := uint64(1)
+		if open := strings.Index(column.ColumnType, "("); open >= 0 {
+			if n, err := strconv.ParseUint(strings.TrimSuffix(column.ColumnType[open+1:], ")"), 10, 64); err == nil {
+				bits = n
+			}
+		}
+		if bits >= 64 {
+			return uint64(0), uint64(math.MaxUint64)
+		}
+		return uint64(0), uint64(1)<<bits - 1
+	}
+	size := map[string]uint{"tinyint": 8, "smallint": 16, "mediumint": 24, "int": 32, "integer": 32}[column.DataType]
+	if size == 0 {
+		size = 64 // bigint
+	}
+	if strings.Contains(column.ColumnType, "unsigned") {
+		if size == 64 {
+			return uint64(0), uint64(math.MaxUint64)
+		}
+		return uint64(0), uint64(1)<<size - 1
+	}
+	return -int64(1) << (size - 1), int64(1)<<(size-1) - 1
+}
+
+// columnDefault - COLUMN_DEFAULT в виде json-значения
+func columnDefault(column *Column) (interface{}, bool) {
+	if !column.Default.Valid {
+		return nil, false
+	}
+	raw := column.Default.String
+	switch column.Kind {
+	case kindInteger, kindYear:
+		i, err := strconv.ParseInt(raw, 10, 64)
+		return i, err == nil
+	case kindUnsigned:
+		u, err := strconv.ParseUint(raw, 10, 64)
+		return u, err == nil
+	case kindBool:
+		return raw != "0", true
+	case kindFloat, kindDecimal:
+		f, err := strconv.ParseFloat(raw, 64)
+		return f, err == nil
+	}
+	return raw, true
+}
+
+// payloadJSONSchema - схема тела вставки, частичного обновления или замены записи
+func payloadJSONSchema(schema *Schema, table *Table, payload string) object {
+	properties := object{}
+	required := make([]string, 0)
+	for _, column := range table.Columns {
+		columnSchema := columnJSONSchema(column)
+		switch {
+		case payload == payloadUpdate && table.IsPrimaryKey(column.Name):
+			properties[column.Name] = false // ключ существующей записи менять нельзя
+			continue
+		case payload == payloadInsert && table.IsPrimaryKey(column.Name) && column.AutoIncrement:
+			columnSchema["readOnly"] = true // значение игнорируется, ключ выдаёт база
+		case payload == payloadReplace && table.IsPrimaryKey(column.Name):
+			// ключ берётся из пути, в теле допустим только совпадающий
+		case payload != payloadUpdate && !column.IsNullable && !column.Default.Valid && !column.AutoIncrement:
+			required = append(required, column.Name)
+		}
+		properties[column.Name] = columnSchema
+	}
+	return object{
+		"$schema":    jsonSchemaDialect,
+		"$id":        "/" + schema.RouteName(table) + "/" + schemaSegment + "/" + payload,
+		"title":      fmt.Sprintf("%s.%s %s", table.Database, table.Name, payload),
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
+
+// fieldError - нарушение схемы в конкретном поле тела запроса, элемент details в ошибке
+type fieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// violation - что не так со значением: машинный код и окончание сообщения "field $name ..."
+type violation struct {
+	code    string
+	message string
+}
+
+func invalidType() []violation {
+	return []violation{{code: "invalid_type", message: "have invalid type"}}
+}
+
+func invalidValue() []violation {
+	return []violation{{code: "invalid_value", message: "has invalid value"}}
+}
+
+// patternCache - скомпилированные pattern схемы, чтобы не компилировать их на каждое значение.
+// Регулярки схемы генерируем мы сами, поэтому ошибка компиляции - просто несовпадение.
+type patternCache map[string]*regexp.Regexp
+
+// compilePatterns компилирует все pattern из properties схемы тела заранее
+func compilePatterns(schema object) patternCache {
+	patterns := make(patternCache)
+	properties, _ := schema["properties"].(object)
+	for _, property := range properties {
+		for s, ok := property.(object); ok; s, ok = s["items"].(object) {
+			if pattern, ok := s["pattern"].(string); ok {
+				patterns.match(pattern, "")
+			}
+		}
+	}
+	return patterns
+}
+
+func (c patternCache) match(pattern, str string) bool {
+	re, ok := c[pattern]
+	if !ok {
+		var err error
+		if re, err = regexp.Compile(pattern); err != nil {
+			return false
+		}
+		if c != nil {
+			c[pattern] = re
+		}
+	}
+	return re.MatchString(str)
+}
+
+// payloadValidator - схема тела для таблицы, собранная один раз:
+// при массовой вставке ею проверяются все строки запроса
+type payloadValidator struct {
+	table    *Table
+	payload  string
+	schema   object
+	patterns patternCache
+}
+
+func (exp *DbExplorer) newValidator(table *Table, payload string) *payloadValidator {
+	schema := payloadJSONSchema(exp.getSchema(), table, payload)
+	return &payloadValidator{table: table, payload: payload, schema: schema, patterns: compilePatterns(schema)}
+}
+
+// validatePayload проверяет тело по схеме таблицы, поля - в порядке колонок
+func validatePayload(schema object, patterns patternCache, table *Table, body map[string]interface{}) []fieldError {
+	errs := make([]fieldError, 0)
+	properties := schema["properties"].(object)
+	required, _ := schema["required"].([]string)
+	for _, column := range table.Columns {
+		value, exist := body[column.Name]
+		if !exist {
+			if Contains(required, column.Name) {
+				errs = append(errs, fieldError{Field: column.Name, Code: "required", Message: fmt.Sprintf("field %s is required", column.Name)})
+			}
+			continue
+		}
+		for _, v := range validateValue(properties[column.Name], value, patterns) {
+			errs = append(errs, fieldError{Field: column.Name, Code: v.code, Message: fmt.Sprintf("field %s %s", column.Name, v.message)})
+		}
+	}
+	return errs
+}
+
+func hasFieldError(errs []fieldError, field string) bool {
+	for _, e := range errs {
+		if e.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// validateValue - минимальный валидатор для тех ключевых слов, что выдаёт columnJSONSchema
+func validateValue(schema interface{}, value interface{}, patterns patternCache) []violation {
+	switch s := schema.(type) {
+	case bool:
+		if !s {
+			return invalidType()
+		}
+		return nil
+	case object:
+		if _, ok := s["not"]; ok {
+			return invalidType() // используем только как {"not": {}}
+		}
+		if types, ok := s["type"]; ok && !matchesType(types, value) {
+			return invalidType()
+		}
+		if members, ok := s["enum"].([]interface{}); ok && !Contains(members, value) {
+			return invalidValue()
+		}
+		if value == nil {
+			return nil
+		}
+		violations := make([]violation, 0)
+		if str, ok := value.(string); ok {
+			if pattern, ok := s["pattern"].(string); ok {
+				if !patterns.match(pattern, str) {
+					if s["items"] != nil {
+						return invalidValue() // строковая запись set
+					}
+					return invalidType()
+				}
+			}
+			if format, ok := s["format"].(string); ok && !matchesFormat(format, str) {
+				return invalidType()
+			}
+			if s["contentEncoding"] == "base64" {
+				if _, err := base64.StdEncoding.DecodeString(str); err != nil {
+					return invalidType()
+				}
+			}
+			if maxLength, ok := s["maxLength"].(int64); ok && int64(utf8.RuneCountInString(str)) > maxLength {
+				violations = append(violations, violation{code: "too_long", message: "is too long"})
+			}
+		}
+		if items, ok := s["items"]; ok {
+			if list, ok := value.([]interface{}); ok {
+				for _, item := range list {
+					if itemViolations := validateValue(items, item, patterns); len(itemViolations) > 0 {
+						return itemViolations
+					}
+				}
+			}
+		}
+		minimum, hasMinimum := s["minimum"]
+		maximum, hasMaximum := s["maximum"]
+		if (hasMinimum && compareNumber(value, minimum) < 0) || (hasMaximum && compareNumber(value, maximum) > 0) {
+			violations = append(violations, violation{code: "out_of_range", message: "is out of range"})
+		}
+		return violations
+	}
+	return nil
+}
+
+func matchesType(types interface{}, value interface{}) bool {
+	switch t := types.(type) {
+	case string:
+		return jsonType(t, value)
+	case []string:
+		for _, name := range t {
+			if jsonType(name, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func jsonType(name string, value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return name == "null"
+	case bool:
+		return name == "boolean"
+	case string:
+		return name == "string"
+	case int64, uint64:
+		return name == "integer" || name == "number"
+	case float64:
+		return name == "number" || (name == "integer" && v == float64(int64(v)))
+	case json.Number:
+		f, ok := bigNumber(v)
+		return ok && (name == "number" || (name == "integer" && f.IsInt()))
+	case map[string]interface{}:
+		return name == "object"
+	case []interface{}:
+		return name == "array"
+	}
+	return false
+}
+
+func matchesFormat(format, value string) bool {
+	switch format {
+	// строго по RFC 3339: full-date и date-time, родные форматы mysql схема не описывает
+	case "date":
+		_, err := time.Parse(mysqlDateLayout, value)
+		return err == nil
+	case "date-time":
+		_, err := time.Parse(time.RFC3339Nano, value)
+		return err == nil
+	case "uuid":
+		_, err := parseUUID(value)
+		return err == nil
+	}
+	return true
+}
+
+// compareNumber сравнивает число из тела запроса с границей из схемы.
+// big.Float нужен, чтобы не терять точность на краях bigint.
+func compareNumber(value interface{}, bound interface{}) int {
+	a, okA := numberToFloat(value)
+	b, okB := numberToFloat(bound)
+	if !okA || !okB {
+		return 0
+	}
+	return a.Cmp(b)
+}
+
+func numberToFloat(value interface{}) (*big.Float, bool) {
+	switch v := value.(type) {
+	case int:
+		return new(big.Float).SetInt64(int64(v)), true
+	case int64:
+		return new(big.Float).SetInt64(v), true
+	case uint64:
+		return new(big.Float).SetUint64(v), true
+	case float64:
+		if math.IsNaN(v) {
+			return nil, false
+		}
+		return new(big.Float).SetFloat64(v), true
+	case json.Number:
+		return bigNumber(v)
+	}
+	return nil, false
+}
+
+func (exp *DbExplorer) PayloadSchema(w http.ResponseWriter, r *http.Request, table *Table, payload string) {
+	w.Header().Set("Content-type", "application/schema+json")
+	json.NewEncoder(w).Encode(payloadJSONSchema(exp.getSchema(), table, payload))
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"reflect"
+	"strings"
 	"testing"
 
 	"bytes"
@@ -20,12 +21,13 @@ import (
 type CR map[string]interface{}
 
 type Case struct {
-	Method string // GET по-умолчанию в http.NewRequest если передали пустую строку
-	Path   string
-	Query  string
-	Status int
-	Result interface{}
-	Body   interface{}
+	Method      string // GET по-умолчанию в http.NewRequest если передали пустую строку
+	Path        string
+	Query       string
+	Status      int
+	Result      interface{}
+	Body        interface{}
+	ContentType string // application/json по-умолчанию
 }
 
 var (
@@ -113,6 +115,9 @@ func TestApis(t *testing.T) {
 			Result: CR{
 				"response": CR{
 					"tables": []string{"items", "users"},
+					"databases": CR{
+						"golang": []string{"items", "users"},
+					},
 				},
 			},
 		},
@@ -176,6 +181,16 @@ func TestApis(t *testing.T) {
 				},
 			},
 		},
+		// страница за концом данных - пустой список, а не 404
+		Case{
+			Path:  "/items",
+			Query: "limit=1&offset=10",
+			Result: CR{
+				"response": CR{
+					"records": []CR{},
+				},
+			},
+		},
 		Case{
 			Path: "/items/1",
 			Result: CR{
@@ -201,6 +216,7 @@ func TestApis(t *testing.T) {
 		Case{
 			Path:   "/items/",
 			Method: http.MethodPut,
+			Status: http.StatusCreated,
 			Body: CR{
 				"id":          42, // auto increment primary key игнорируется при вставке
 				"title":       "db_crud",
@@ -355,6 +371,40 @@ func TestApis(t *testing.T) {
 			},
 		},
 
+		Case{
+			Path:   "/items/100500",
+			Method: http.MethodPost,
+			Status: http.StatusNotFound,
+			Body: CR{
+				"title": "missing",
+			},
+			Result: CR{
+				"error": "record not found",
+			},
+		},
+		Case{
+			Path:   "/items/3",
+			Method: http.MethodPut,
+			Status: http.StatusMethodNotAllowed,
+			Result: CR{
+				"error": "method not allowed",
+			},
+		},
+		// ?pk. адресует запись, создание по нему не должно вставлять новую строку
+		Case{
+			Path:   "/items",
+			Query:  "pk.id=3",
+			Method: http.MethodPut,
+			Status: http.StatusMethodNotAllowed,
+			Body: CR{
+				"title":       "db_crud",
+				"description": "",
+			},
+			Result: CR{
+				"error": "method not allowed",
+			},
+		},
+
 		// удаление
 		Case{
 			Path:   "/items/3",
@@ -443,6 +493,7 @@ func TestApis(t *testing.T) {
 		Case{
 			Path:   "/users/",
 			Method: http.MethodPut,
+			Status: http.StatusCreated,
 			Body: CR{
 				"user_id":    2,
 				"login":      "qwerty'",
@@ -500,6 +551,253 @@ func TestApis(t *testing.T) {
 				},
 			},
 		},
+		// id приводится к типу колонки ключа
+		Case{
+			Path:   "/items/abc",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "invalid value for key id",
+			},
+		},
+		// фильтры
+		Case{
+			Path:  "/users",
+			Query: "filter.email.like=%25@example.com",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{
+							"user_id":  1,
+							"login":    "rvasily",
+							"password": "love",
+							"email":    "rvasily@example.com",
+							"info":     "try update",
+							"updated":  "now",
+						},
+					},
+				},
+			},
+		},
+		Case{
+			Path:  "/users",
+			Query: "filter.updated.null=true&filter.user_id.in=1,2",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{
+							"user_id":  2,
+							"login":    "qwerty'",
+							"password": "love\"",
+							"email":    "",
+							"info":     "",
+							"updated":  nil,
+						},
+					},
+				},
+			},
+		},
+		Case{
+			Path:   "/users",
+			Query:  "filter.unknown.eq=1",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "unknown filter column unknown",
+			},
+		},
+		Case{
+			Path:   "/users",
+			Query:  "filter.user_id.between=1",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "invalid value for filter user_id.between",
+			},
+		},
+		// сортировка
+		Case{
+			Path:  "/users",
+			Query: "sort=-user_id&limit=1",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{
+							"user_id":  2,
+							"login":    "qwerty'",
+							"password": "love\"",
+							"email":    "",
+							"info":     "",
+							"updated":  nil,
+						},
+					},
+				},
+			},
+		},
+		Case{
+			Path:   "/users",
+			Query:  "sort=-unknown",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "unknown sort column unknown",
+			},
+		},
+		// постраничный вывод по курсору
+		Case{
+			Path:  "/items",
+			Query: "cursor=&limit=1",
+			Result: CR{
+				"response": CR{
+					"next": "eyJzIjoiaWQiLCJ2IjpbMV19",
+					"records": []CR{
+						CR{
+							"id":          1,
+							"title":       "database/sql",
+							"description": "Рассказать про базы данных",
+							"updated":     "rvasily",
+						},
+					},
+				},
+			},
+		},
+		Case{
+			Path:  "/items",
+			Query: "cursor=eyJzIjoiaWQiLCJ2IjpbMV19&limit=1",
+			Result: CR{
+				"response": CR{
+					"prev": "eyJzIjoiaWQiLCJwIjp0cnVlLCJ2IjpbMl19",
+					"records": []CR{
+						CR{
+							"id":          2,
+							"title":       "memcache",
+							"description": "Рассказать про мемкеш с примером использования",
+							"updated":     nil,
+						},
+					},
+				},
+			},
+		},
+		Case{
+			Path:  "/items",
+			Query: "cursor=eyJzIjoiaWQiLCJwIjp0cnVlLCJ2IjpbMl19&limit=1",
+			Result: CR{
+				"response": CR{
+					"next": "eyJzIjoiaWQiLCJ2IjpbMV19",
+					"records": []CR{
+						CR{
+							"id":          1,
+							"title":       "database/sql",
+							"description": "Рассказать про базы данных",
+							"updated":     "rvasily",
+						},
+					},
+				},
+			},
+		},
+		// курсор после последней строки - пустая страница без next
+		Case{
+			Path:  "/items",
+			Query: "cursor=eyJzIjoiaWQiLCJ2IjpbMl19&limit=1",
+			Result: CR{
+				"response": CR{
+					"records": []CR{},
+				},
+			},
+		},
+		Case{
+			Path:   "/items",
+			Query:  "cursor=eyJzIjoiaWQiLCJ2IjpbMV19&sort=-id",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "cursor does not match sort",
+			},
+		},
+		// метаданные страницы
+		Case{
+			Path:  "/items",
+			Query: "total=exact&limit=1",
+			Result: CR{
+				"response": CR{
+					"page": CR{
+						"limit":      1,
+						"offset":     0,
+						"total":      2,
+						"total_type": "exact",
+						"next":       "/items?limit=1&offset=1&total=exact",
+					},
+					"records": []CR{
+						CR{
+							"id":          1,
+							"title":       "database/sql",
+							"description": "Рассказать про базы данных",
+							"updated":     "rvasily",
+						},
+					},
+				},
+			},
+		},
+		Case{
+			Path:   "/items",
+			Query:  "total=estimate&filter.id.eq=1",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "estimate total is not available with filter",
+			},
+		},
+		// выборка отдельных колонок
+		Case{
+			Path:  "/users/1",
+			Query: "fields=login,email",
+			Result: CR{
+				"response": CR{
+					"record": CR{
+						"user_id": 1,
+						"login":   "rvasily",
+						"email":   "rvasily@example.com",
+					},
+				},
+			},
+		},
+		Case{
+			Path:  "/items",
+			Query: "fields=title&cursor=&limit=1&sort=-updated",
+			Result: CR{
+				"response": CR{
+					"next": "eyJzIjoiLXVwZGF0ZWQsaWQiLCJ2IjpbInJ2YXNpbHkiLDFdfQ",
+					"records": []CR{
+						CR{
+							"id":    1,
+							"title": "database/sql",
+						},
+					},
+				},
+			},
+		},
+		Case{
+			Path:   "/items",
+			Query:  "fields=unknown",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "unknown field unknown",
+			},
+		},
+		// полное имя таблицы вместе с базой
+		Case{
+			Path:  "/golang/users/1",
+			Query: "fields=login",
+			Result: CR{
+				"response": CR{
+					"record": CR{
+						"user_id": 1,
+						"login":   "rvasily",
+					},
+				},
+			},
+		},
+		Case{
+			Path:   "/unknown_db/users",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "unknown table",
+			},
+		},
 	}
 
 	runCases(t, ts, db, cases)
@@ -534,7 +832,10 @@ func runCases(t *testing.T, ts *httptest.Server, db *sql.DB, cases []Case) {
 			}
 			reqBody := bytes.NewReader(data)
 			req, _ = http.NewRequest(item.Method, ts.URL+item.Path, reqBody)
-			req.Header.Add("Content-Type", "application/json")
+			if item.ContentType == "" {
+				item.ContentType = "application/json"
+			}
+			req.Header.Add("Content-Type", item.ContentType)
 		}
 
 		resp, err := client.Do(req)
@@ -575,3 +876,1779 @@ func runCases(t *testing.T, ts *httptest.Server, db *sql.DB, cases []Case) {
 	}
 
 }
+
+func TestCompositeKeys(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	if err != nil {
+		panic(err)
+	}
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	qs := []string{
+		`DROP TABLE IF EXISTS user_roles;`,
+		`CREATE TABLE user_roles (
+  user_id int(11) NOT NULL,
+  role_id int(11) NOT NULL,
+  granted varchar(255) DEFAULT NULL,
+  PRIMARY KEY (user_id, role_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;`,
+		`INSERT INTO user_roles (user_id, role_id, granted) VALUES (1, 42, 'rvasily');`,
+	}
+	for _, q := range qs {
+		if _, err := db.Exec(q); err != nil {
+			panic(err)
+		}
+	}
+	defer db.Exec(`DROP TABLE IF EXISTS user_roles;`)
+
+	handler, err := NewDbExplorer(db)
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(handler)
+
+	cases := []Case{
+		Case{
+			Path: "/user_roles/1,42",
+			Result: CR{
+				"response": CR{
+					"record": CR{
+						"user_id": 1,
+						"role_id": 42,
+						"granted": "rvasily",
+					},
+				},
+			},
+		},
+		Case{
+			Path:  "/user_roles",
+			Query: "pk.user_id=1&pk.role_id=42",
+			Result: CR{
+				"response": CR{
+					"record": CR{
+						"user_id": 1,
+						"role_id": 42,
+						"granted": "rvasily",
+					},
+				},
+			},
+		},
+		Case{
+			Path:   "/user_roles/1",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "id must contain 2 values: user_id,role_id",
+			},
+		},
+		Case{
+			Path:   "/user_roles/",
+			Method: http.MethodPut,
+			Status: http.StatusCreated,
+			Body: CR{
+				"user_id": 2,
+				"role_id": 7,
+			},
+			Result: CR{
+				"response": CR{
+					"user_id": 2,
+					"role_id": 7,
+				},
+			},
+		},
+		Case{
+			Path:   "/user_roles/2,7",
+			Method: http.MethodPost,
+			Status: http.StatusBadRequest,
+			Body: CR{
+				"role_id": 8, // части ключа тоже нельзя менять
+			},
+			Result: CR{
+				"error": "field role_id have invalid type",
+			},
+		},
+		Case{
+			Path:   "/user_roles?pk.user_id=2&pk.role_id=7",
+			Method: http.MethodDelete,
+			Result: CR{
+				"response": CR{
+					"deleted": 1,
+				},
+			},
+		},
+	}
+
+	runCases(t, ts, db, cases)
+}
+
+func TestPrimaryKeys(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	if err != nil {
+		panic(err)
+	}
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	qs := []string{
+		`DROP TABLE IF EXISTS logs;`,
+		`DROP TABLE IF EXISTS tags;`,
+		// без ключа вообще
+		`CREATE TABLE logs (
+  msg varchar(255) NOT NULL,
+  created int(11) DEFAULT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;`,
+		`INSERT INTO logs (msg, created) VALUES ('started', 1), ('stopped', 2);`,
+		// без PRIMARY KEY, но уникальный NOT NULL индекс mysql помечает как PRI
+		`CREATE TABLE tags (
+  name varchar(64) NOT NULL,
+  note varchar(255) DEFAULT NULL,
+  UNIQUE KEY name (name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;`,
+		`INSERT INTO tags (name, note) VALUES ('go', 'lang');`,
+	}
+	for _, q := range qs {
+		if _, err := db.Exec(q); err != nil {
+			panic(err)
+		}
+	}
+	defer db.Exec(`DROP TABLE IF EXISTS logs;`)
+	defer db.Exec(`DROP TABLE IF EXISTS tags;`)
+
+	handler, err := NewDbExplorer(db)
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(handler)
+
+	cases := []Case{
+		Case{
+			Path: "/logs",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{"msg": "started", "created": 1},
+						CR{"msg": "stopped", "created": 2},
+					},
+				},
+			},
+		},
+		Case{
+			Path:   "/logs/1",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "table logs has no primary key",
+			},
+		},
+		Case{
+			Path:   "/logs/1",
+			Method: http.MethodDelete,
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "table logs has no primary key",
+			},
+		},
+		Case{
+			Path: "/tags/go",
+			Result: CR{
+				"response": CR{
+					"record": CR{
+						"name": "go",
+						"note": "lang",
+					},
+				},
+			},
+		},
+	}
+
+	runCases(t, ts, db, cases)
+}
+
+func TestBinaryKeys(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	if err != nil {
+		panic(err)
+	}
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	qs := []string{
+		`DROP TABLE IF EXISTS blobs;`,
+		`CREATE TABLE blobs (
+  k varbinary(16) NOT NULL,
+  v varchar(255) DEFAULT NULL,
+  PRIMARY KEY (k)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;`,
+	}
+	for _, q := range qs {
+		if _, err := db.Exec(q); err != nil {
+			panic(err)
+		}
+	}
+	defer db.Exec(`DROP TABLE IF EXISTS blobs;`)
+
+	handler, err := NewDbExplorer(db)
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(handler)
+
+	// ключ 0xfb 0xff: в обычном base64 "+/8=", в пути - base64url "-_8"
+	req, _ := http.NewRequest(http.MethodPut, ts.URL+"/blobs/", bytes.NewReader([]byte(`{"k": "+/8=", "v": "x"}`)))
+	req.Header.Add("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected http status %v, got %v", http.StatusCreated, resp.StatusCode)
+	}
+	if location := resp.Header.Get("Location"); location != "/blobs/-_8" {
+		t.Fatalf("expected Location /blobs/-_8, got %s", location)
+	}
+
+	cases := []Case{
+		Case{
+			Path: "/blobs/-_8",
+			Result: CR{
+				"response": CR{
+					"record": CR{
+						"k": "+/8=",
+						"v": "x",
+					},
+				},
+			},
+		},
+		Case{
+			Path:  "/blobs",
+			Query: "pk.k=-_8",
+			Result: CR{
+				"response": CR{
+					"record": CR{
+						"k": "+/8=",
+						"v": "x",
+					},
+				},
+			},
+		},
+	}
+
+	runCases(t, ts, db, cases)
+}
+
+func TestColumnTypes(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	if err != nil {
+		panic(err)
+	}
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	qs := []string{
+		`DROP TABLE IF EXISTS measurements;`,
+		`CREATE TABLE measurements (
+  id int(11) NOT NULL AUTO_INCREMENT,
+  price decimal(10,2) NOT NULL,
+  active tinyint(1) NOT NULL DEFAULT 0,
+  counter bigint(20) unsigned NOT NULL,
+  day date DEFAULT NULL,
+  created datetime DEFAULT NULL,
+  meta json DEFAULT NULL,
+  data blob,
+  total decimal(30,2) DEFAULT NULL,
+  PRIMARY KEY (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;`,
+	}
+	for _, q := range qs {
+		if _, err := db.Exec(q); err != nil {
+			panic(err)
+		}
+	}
+	defer db.Exec(`DROP TABLE IF EXISTS measurements;`)
+
+	handler, err := NewDbExplorer(db)
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(handler)
+
+	cases := []Case{
+		Case{
+			Path:   "/measurements/",
+			Method: http.MethodPut,
+			Status: http.StatusCreated,
+			Body: CR{
+				"price":   "12.50",
+				"active":  true,
+				"counter": uint64(18446744073709551615),
+				"day":     "2023-01-02",
+				"created": "2023-01-02T03:04:05Z",
+				"meta":    CR{"a": 1},
+				"data":    "AQID", // base64
+			},
+			Result: CR{
+				"response": CR{
+					"id": 1,
+				},
+			},
+		},
+		Case{
+			Path: "/measurements/1",
+			Result: CR{
+				"response": CR{
+					"record": CR{
+						"id":      1,
+						"price":   12.50,
+						"active":  true,
+						"counter": uint64(18446744073709551615),
+						"day":     "2023-01-02",
+						"created": "2023-01-02T03:04:05Z",
+						"meta":    CR{"a": 1},
+						"data":    "AQID",
+						"total":   nil,
+					},
+				},
+			},
+		},
+		Case{
+			Path:  "/measurements",
+			Query: "meta=1",
+			Result: CR{
+				"response": CR{
+					"columns": []CR{
+						CR{"name": "id", "type": "INT", "nullable": false, "kind": "integer"},
+						CR{"name": "price", "type": "DECIMAL", "nullable": false, "kind": "decimal"},
+						CR{"name": "active", "type": "TINYINT", "nullable": false, "kind": "bool"},
+						CR{"name": "counter", "type": "UNSIGNED BIGINT", "nullable": false, "kind": "unsigned"},
+						CR{"name": "day", "type": "DATE", "nullable": true, "kind": "date"},
+						CR{"name": "created", "type": "DATETIME", "nullable": true, "kind": "datetime"},
+						CR{"name": "meta", "type": "JSON", "nullable": true, "kind": "json"},
+						CR{"name": "data", "type": "BLOB", "nullable": true, "kind": "binary"},
+						CR{"name": "total", "type": "DECIMAL", "nullable": true, "kind": "decimal"},
+					},
+					"page": CR{
+						"limit":  5,
+						"offset": 0,
+					},
+					"records": []CR{
+						CR{
+							"id":      1,
+							"price":   12.50,
+							"active":  true,
+							"counter": uint64(18446744073709551615),
+							"day":     "2023-01-02",
+							"created": "2023-01-02T03:04:05Z",
+							"meta":    CR{"a": 1},
+							"data":    "AQID",
+							"total":   nil,
+						},
+					},
+				},
+			},
+		},
+		Case{
+			Path:   "/measurements/1",
+			Method: http.MethodPost,
+			Status: http.StatusBadRequest,
+			Body: CR{
+				"active": "yes",
+			},
+			Result: CR{
+				"error": "field active have invalid type",
+			},
+		},
+		Case{
+			Path:   "/measurements/",
+			Method: http.MethodPut,
+			Status: http.StatusBadRequest,
+			Body: CR{
+				"price": "12.50",
+			},
+			Result: CR{
+				"error": "field counter is required",
+			},
+		},
+		Case{
+			Path:   "/measurements/",
+			Method: http.MethodPut,
+			Status: http.StatusBadRequest,
+			Body: CR{
+				"price":   "twelve",
+				"counter": 1,
+			},
+			Result: CR{
+				"error": "field price have invalid type",
+			},
+		},
+		Case{
+			Path:   "/measurements/",
+			Method: http.MethodPut,
+			Status: http.StatusBadRequest,
+			Body: CR{
+				"price":   "1",
+				"active":  300, // tinyint(1)
+				"counter": -1,
+			},
+			Result: CR{
+				"error": "field active is out of range; field counter is out of range",
+			},
+		},
+		// форматы date и date-time проверяются строго по RFC 3339, как в опубликованной схеме
+		Case{
+			Path:   "/measurements/",
+			Method: http.MethodPut,
+			Status: http.StatusBadRequest,
+			Body: CR{
+				"price":   "1",
+				"counter": 1,
+				"day":     "2023-01-02T03:04:05Z",
+				"created": "2023-01-02 03:04:05",
+			},
+			Result: CR{
+				"error": "field day have invalid type; field created have invalid type",
+			},
+		},
+		// число в теле для decimal не проходит через float64
+		Case{
+			Path:   "/measurements/",
+			Method: http.MethodPut,
+			Status: http.StatusCreated,
+			Body: CR{
+				"price":   json.Number("1"),
+				"counter": 1,
+				"total":   json.Number("12345678901234567.89"),
+			},
+			Result: CR{
+				"response": CR{
+					"id": 2,
+				},
+			},
+		},
+		Case{
+			Path:  "/measurements",
+			Query: "fields=id&filter.total.eq=12345678901234567.89",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{"id": 2},
+					},
+				},
+			},
+		},
+	}
+
+	runCases(t, ts, db, cases)
+}
+
+func TestVisibility(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	if err != nil {
+		panic(err)
+	}
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	PrepareTestApis(db)
+	defer CleanupTestApis(db)
+
+	handler, err := NewDbExplorer(db, WithTables(nil, []string{"golang.users"}))
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(handler)
+
+	cases := []Case{
+		Case{
+			Path: "/",
+			Result: CR{
+				"response": CR{
+					"tables": []string{"items"},
+					"databases": CR{
+						"golang": []string{"items"},
+					},
+				},
+			},
+		},
+		Case{
+			Path:   "/users/1",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "unknown table",
+			},
+		},
+	}
+
+	runCases(t, ts, db, cases)
+}
+
+func TestTableSchema(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	if err != nil {
+		panic(err)
+	}
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	qs := []string{
+		`DROP TABLE IF EXISTS order_items;`,
+		`DROP TABLE IF EXISTS orders;`,
+		`CREATE TABLE orders (
+  id int(11) NOT NULL AUTO_INCREMENT,
+  shop_id int(11) NOT NULL,
+  number int(11) NOT NULL,
+  PRIMARY KEY (id),
+  UNIQUE KEY shop_number (shop_id, number)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;`,
+		// составные индекс и внешний ключ проверяют группировку колонок по имени и порядку
+		`CREATE TABLE order_items (
+  id int(11) NOT NULL AUTO_INCREMENT,
+  order_id int(11) NOT NULL,
+  line int(11) NOT NULL,
+  shop_id int(11) NOT NULL,
+  order_number int(11) NOT NULL,
+  sku varchar(32) NOT NULL,
+  qty int(11) NOT NULL DEFAULT 1,
+  PRIMARY KEY (id),
+  UNIQUE KEY uniq_line (order_id, line),
+  KEY sku (sku),
+  KEY shop_order (shop_id, order_number),
+  CONSTRAINT fk_order FOREIGN KEY (order_id) REFERENCES orders (id),
+  CONSTRAINT fk_shop_order FOREIGN KEY (shop_id, order_number) REFERENCES orders (shop_id, number)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;`,
+	}
+	for _, q := range qs {
+		if _, err := db.Exec(q); err != nil {
+			panic(err)
+		}
+	}
+	defer db.Exec(`DROP TABLE IF EXISTS orders;`)
+	defer db.Exec(`DROP TABLE IF EXISTS order_items;`)
+
+	handler, err := NewDbExplorer(db)
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(handler)
+
+	cases := []Case{
+		Case{
+			Path: "/order_items/_schema",
+			Result: CR{
+				"response": CR{
+					"schema": CR{
+						"database":    "golang",
+						"name":        "order_items",
+						"primary_key": []string{"id"},
+						"columns": []CR{
+							CR{"name": "id", "type": "int(11)", "kind": "integer", "nullable": false, "default": nil, "auto_increment": true, "key": "PRI"},
+							CR{"name": "order_id", "type": "int(11)", "kind": "integer", "nullable": false, "default": nil, "auto_increment": false, "key": "MUL"},
+							CR{"name": "line", "type": "int(11)", "kind": "integer", "nullable": false, "default": nil, "auto_increment": false},
+							CR{"name": "shop_id", "type": "int(11)", "kind": "integer", "nullable": false, "default": nil, "auto_increment": false, "key": "MUL"},
+							CR{"name": "order_number", "type": "int(11)", "kind": "integer", "nullable": false, "default": nil, "auto_increment": false},
+							CR{"name": "sku", "type": "varchar(32)", "kind": "string", "nullable": false, "default": nil, "auto_increment": false, "key": "MUL", "max_length": 32},
+							CR{"name": "qty", "type": "int(11)", "kind": "integer", "nullable": false, "default": "1", "auto_increment": false},
+						},
+						"indexes": []CR{
+							CR{"name": "PRIMARY", "columns": []string{"id"}, "unique": true},
+							CR{"name": "shop_order", "columns": []string{"shop_id", "order_number"}, "unique": false},
+							CR{"name": "sku", "columns": []string{"sku"}, "unique": false},
+							CR{"name": "uniq_line", "columns": []string{"order_id", "line"}, "unique": true},
+						},
+						"foreign_keys": []CR{
+							CR{
+								"name":                "fk_order",
+								"columns":             []string{"order_id"},
+								"referenced_database": "golang",
+								"referenced_table":    "orders",
+								"referenced_columns":  []string{"id"},
+							},
+							CR{
+								"name":                "fk_shop_order",
+								"columns":             []string{"shop_id", "order_number"},
+								"referenced_database": "golang",
+								"referenced_table":    "orders",
+								"referenced_columns":  []string{"shop_id", "number"},
+							},
+						},
+					},
+				},
+			},
+		},
+		Case{
+			Path: "/orders/_schema",
+			Result: CR{
+				"response": CR{
+					"schema": CR{
+						"database":    "golang",
+						"name":        "orders",
+						"primary_key": []string{"id"},
+						"columns": []CR{
+							CR{"name": "id", "type": "int(11)", "kind": "integer", "nullable": false, "default": nil, "auto_increment": true, "key": "PRI"},
+							CR{"name": "shop_id", "type": "int(11)", "kind": "integer", "nullable": false, "default": nil, "auto_increment": false, "key": "MUL"},
+							CR{"name": "number", "type": "int(11)", "kind": "integer", "nullable": false, "default": nil, "auto_increment": false},
+						},
+						"indexes": []CR{
+							CR{"name": "PRIMARY", "columns": []string{"id"}, "unique": true},
+							CR{"name": "shop_number", "columns": []string{"shop_id", "number"}, "unique": true},
+						},
+						"foreign_keys": []CR{},
+					},
+				},
+			},
+		},
+		Case{
+			Path:   "/order_items/_schema",
+			Method: http.MethodPost,
+			Status: http.StatusMethodNotAllowed,
+			Result: CR{
+				"error": "method not allowed",
+			},
+		},
+	}
+
+	runCases(t, ts, db, cases)
+}
+
+func TestOpenAPI(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	if err != nil {
+		panic(err)
+	}
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	PrepareTestApis(db)
+	defer CleanupTestApis(db)
+
+	legacy, err := NewDbExplorer(db)
+	if err != nil {
+		panic(err)
+	}
+	restful, err := NewDbExplorer(db, WithRouting(RESTfulRouting))
+	if err != nil {
+		panic(err)
+	}
+
+	fetch := func(ts *httptest.Server) map[string]interface{} {
+		resp, err := client.Get(ts.URL + "/_openapi.json")
+		if err != nil {
+			t.Fatalf("request error: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected http status %v, got %v", http.StatusOK, resp.StatusCode)
+		}
+		var doc map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+			t.Fatalf("cant unpack json: %v", err)
+		}
+		return doc
+	}
+	// lookup - значение по цепочке ключей, nil если какого-то ключа нет
+	lookup := func(doc map[string]interface{}, keys ...string) interface{} {
+		var value interface{} = doc
+		for _, key := range keys {
+			obj, ok := value.(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			value = obj[key]
+		}
+		return value
+	}
+	expectKeys := func(doc map[string]interface{}, exist bool, keys ...string) {
+		if found := lookup(doc, keys...) != nil; found != exist {
+			t.Fatalf("expected %v to exist: %v", keys, exist)
+		}
+	}
+
+	ts := httptest.NewServer(legacy)
+	doc := fetch(ts)
+	if version := lookup(doc, "openapi"); version != "3.0.3" {
+		t.Fatalf("expected openapi 3.0.3, got %v", version)
+	}
+	expectKeys(doc, true, "paths", "/items", "get")
+	expectKeys(doc, true, "paths", "/items", "put")
+	expectKeys(doc, false, "paths", "/items", "post")
+	expectKeys(doc, true, "paths", "/items/{id}", "get")
+	expectKeys(doc, true, "paths", "/items/{id}", "post")
+	expectKeys(doc, false, "paths", "/items/{id}", "put")
+	expectKeys(doc, true, "paths", "/users/{id}", "delete")
+	expectKeys(doc, true, "paths", "/items/_schema/insert", "get")
+	expectKeys(doc, true, "components", "schemas", "items")
+	expectKeys(doc, true, "components", "schemas", "items.create")
+	expectKeys(doc, true, "components", "schemas", "items.update")
+	expectKeys(doc, false, "components", "schemas", "items.replace")
+	expectKeys(doc, true, "components", "schemas", "Error")
+	expectKeys(doc, true, "components", "schemas", "Problem")
+	expectKeys(doc, true, "components", "responses", "Error400", "content", "application/json")
+	expectKeys(doc, true, "components", "responses", "Error400", "content", "application/problem+json")
+	if ref := lookup(doc, "paths", "/items/{id}", "get", "responses", "404", "$ref"); ref != "#/components/responses/Error404" {
+		t.Fatalf("expected 404 response ref, got %v", ref)
+	}
+	if ref := lookup(doc, "paths", "/items", "put", "requestBody", "content", "application/x-ndjson", "schema", "$ref"); ref != "#/components/schemas/items.create" {
+		t.Fatalf("expected items.create body ref, got %v", ref)
+	}
+	if kind := lookup(doc, "components", "schemas", "items", "properties", "description", "type"); kind != "string" {
+		t.Fatalf("expected description of type string, got %v", kind)
+	}
+
+	// в RESTful режиме POST и PUT меняются местами
+	doc = fetch(httptest.NewServer(restful))
+	expectKeys(doc, true, "paths", "/items", "post")
+	expectKeys(doc, false, "paths", "/items", "put")
+	expectKeys(doc, true, "paths", "/items/{id}", "put")
+	expectKeys(doc, false, "paths", "/items/{id}", "post")
+	expectKeys(doc, true, "paths", "/items/{id}", "patch")
+	expectKeys(doc, true, "components", "schemas", "items.replace")
+	if ref := lookup(doc, "paths", "/items/{id}", "put", "requestBody", "content", "application/json", "schema", "$ref"); ref != "#/components/schemas/items.replace" {
+		t.Fatalf("expected items.replace body ref, got %v", ref)
+	}
+
+	resp, err := client.Post(ts.URL+"/_openapi.json", "application/json", nil)
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("expected http status %v, got %v", http.StatusMethodNotAllowed, resp.StatusCode)
+	}
+	if allow := resp.Header.Get("Allow"); allow != http.MethodGet {
+		t.Fatalf("expected Allow: GET, got %s", allow)
+	}
+}
+
+func TestPayloadSchema(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	if err != nil {
+		panic(err)
+	}
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	PrepareTestApis(db)
+	defer CleanupTestApis(db)
+
+	handler, err := NewDbExplorer(db)
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(handler)
+
+	// fetch - опубликованная схема тела, та же, по которой сервер проверяет запросы
+	fetch := func(payload string) map[string]interface{} {
+		resp, err := client.Get(ts.URL + "/items/_schema/" + payload)
+		if err != nil {
+			t.Fatalf("request error: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("[%s] expected http status %v, got %v", payload, http.StatusOK, resp.StatusCode)
+		}
+		if contentType := resp.Header.Get("Content-Type"); contentType != "application/schema+json" {
+			t.Fatalf("[%s] expected schema content type, got %s", payload, contentType)
+		}
+		var schema map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&schema); err != nil {
+			t.Fatalf("[%s] cant unpack json: %v", payload, err)
+		}
+		return schema
+	}
+	expect := func(payload string, got, want interface{}) {
+		var expected interface{}
+		data, _ := json.Marshal(want)
+		json.Unmarshal(data, &expected)
+		if !reflect.DeepEqual(got, expected) {
+			t.Fatalf("[%s] results not match\nGot : %#v\nWant: %#v", payload, got, expected)
+		}
+	}
+
+	insert := fetch(payloadInsert)
+	properties, _ := insert["properties"].(map[string]interface{})
+	expect(payloadInsert, insert["$id"], "/items/_schema/insert")
+	expect(payloadInsert, insert["required"], []string{"title", "description"})
+	expect(payloadInsert, properties["id"], CR{"type": "integer", "minimum": -2147483648, "maximum": 2147483647, "readOnly": true})
+	expect(payloadInsert, properties["title"], CR{"type": "string", "maxLength": 255})
+
+	update := fetch(payloadUpdate)
+	properties, _ = update["properties"].(map[string]interface{})
+	expect(payloadUpdate, update["required"], []string{})
+	expect(payloadUpdate, properties["id"], false)
+	expect(payloadUpdate, properties["title"], CR{"type": "string", "maxLength": 255})
+
+	// что запрещает схема, то отклоняет и сервер
+	runCases(t, ts, db, []Case{
+		Case{
+			Path:   "/items/",
+			Method: http.MethodPut,
+			Status: http.StatusBadRequest,
+			Body: CR{
+				"title":       strings.Repeat("x", 256),
+				"description": "",
+			},
+			Result: CR{
+				"error": "field title is too long",
+			},
+		},
+		Case{
+			Path:   "/items/_schema/unknown",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "unknown method",
+			},
+		},
+	})
+}
+
+func TestReload(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	if err != nil {
+		panic(err)
+	}
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	PrepareTestApis(db)
+	defer CleanupTestApis(db)
+	defer db.Exec(`DROP TABLE IF EXISTS reload_check;`)
+
+	closed, err := NewDbExplorer(db)
+	if err != nil {
+		panic(err)
+	}
+	handler, err := NewDbExplorer(db, WithReloadEndpoint())
+	if err != nil {
+		panic(err)
+	}
+
+	// таблица появилась после NewDbExplorer
+	if _, err := db.Exec(`CREATE TABLE reload_check (id int(11) NOT NULL AUTO_INCREMENT, PRIMARY KEY (id)) ENGINE=InnoDB;`); err != nil {
+		panic(err)
+	}
+
+	// без опции маршрута нет, /_reload - просто неизвестная таблица
+	runCases(t, httptest.NewServer(closed), db, []Case{
+		Case{
+			Path:   "/_reload",
+			Method: http.MethodPost,
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "unknown table",
+			},
+		},
+	})
+
+	runCases(t, httptest.NewServer(handler), db, []Case{
+		Case{
+			Path:   "/reload_check",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "unknown table",
+			},
+		},
+		Case{
+			Path:   "/_reload",
+			Status: http.StatusMethodNotAllowed,
+			Result: CR{
+				"error": "method not allowed",
+			},
+		},
+		Case{
+			Path:   "/_reload",
+			Method: http.MethodPost,
+			Result: CR{
+				"response": CR{
+					"tables": 3,
+				},
+			},
+		},
+		Case{
+			Path: "/reload_check",
+			Result: CR{
+				"response": CR{
+					"records": []CR{},
+				},
+			},
+		},
+	})
+
+	if err := closed.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if _, err := closed.getSchema().FindTable("reload_check"); err != nil {
+		t.Errorf("table not found after Reload: %v", err)
+	}
+}
+
+func TestProblemErrors(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	if err != nil {
+		panic(err)
+	}
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	PrepareTestApis(db)
+	defer CleanupTestApis(db)
+
+	handler, err := NewDbExplorer(db)
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(handler)
+
+	req, _ := http.NewRequest(http.MethodPut, ts.URL+"/items/", bytes.NewReader([]byte(`{"title": 1}`)))
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Accept", "application/problem+json")
+	req.Header.Add("X-Request-Id", "req-1")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected http status %v, got %v", http.StatusBadRequest, resp.StatusCode)
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "application/problem+json" {
+		t.Fatalf("expected problem content type, got %s", contentType)
+	}
+
+	var result interface{}
+	body, _ := io.ReadAll(resp.Body)
+	if err := json.Unmarshal(body, &result); err != nil {
+		t.Fatalf("cant unpack json: %v", err)
+	}
+
+	var expected interface{}
+	data, _ := json.Marshal(CR{
+		"type":   "about:blank",
+		"title":  "Bad Request",
+		"status": 400,
+		"code":   "validation_failed",
+		"detail": "field title have invalid type; field description is required",
+		"details": []CR{
+			CR{"field": "title", "code": "invalid_type", "message": "field title have invalid type"},
+			CR{"field": "description", "code": "required", "message": "field description is required"},
+		},
+		"request_id": "req-1",
+	})
+	json.Unmarshal(data, &expected)
+
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("results not match\nGot : %#v\nWant: %#v", result, expected)
+	}
+}
+
+func TestRESTfulRouting(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	if err != nil {
+		panic(err)
+	}
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	PrepareTestApis(db)
+	defer CleanupTestApis(db)
+
+	qs := []string{
+		`DROP TABLE IF EXISTS prices;`,
+		`CREATE TABLE prices (
+  amount decimal(10,2) NOT NULL,
+  label varchar(255) NOT NULL,
+  PRIMARY KEY (amount)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;`,
+		`INSERT INTO prices (amount, label) VALUES (1.50, 'cheap');`,
+	}
+	for _, q := range qs {
+		if _, err := db.Exec(q); err != nil {
+			panic(err)
+		}
+	}
+	defer db.Exec(`DROP TABLE IF EXISTS prices;`)
+
+	handler, err := NewDbExplorer(db, WithRouting(RESTfulRouting))
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(handler)
+
+	cases := []Case{
+		Case{
+			Path:   "/items/",
+			Method: http.MethodPost,
+			Status: http.StatusCreated,
+			Body: CR{
+				"title":       "db_crud",
+				"description": "",
+				"updated":     "rvasily",
+			},
+			Result: CR{
+				"response": CR{
+					"id": 3,
+				},
+			},
+		},
+		Case{
+			Path:   "/items/3",
+			Method: http.MethodPut,
+			Body: CR{
+				"id":          3,
+				"title":       "db_crud",
+				"description": "Написать программу db_crud",
+			},
+			Result: CR{
+				"response": CR{
+					"updated": 1,
+				},
+			},
+		},
+		Case{
+			Path: "/items/3",
+			Result: CR{
+				"response": CR{
+					"record": CR{
+						"id":          3,
+						"title":       "db_crud",
+						"description": "Написать программу db_crud",
+						"updated":     nil, // при замене не указанное поле получает default
+					},
+				},
+			},
+		},
+		Case{
+			Path:   "/items/3",
+			Method: http.MethodPatch,
+			Body: CR{
+				"updated": "autotests",
+			},
+			Result: CR{
+				"response": CR{
+					"updated": 1,
+				},
+			},
+		},
+		Case{
+			Path:   "/items/3",
+			Method: http.MethodPut,
+			Status: http.StatusBadRequest,
+			Body: CR{
+				"title": "db_crud",
+			},
+			Result: CR{
+				"error": "field description is required",
+			},
+		},
+		Case{
+			Path:   "/items/3",
+			Method: http.MethodPut,
+			Status: http.StatusBadRequest,
+			Body: CR{
+				"id":          4,
+				"title":       "db_crud",
+				"description": "",
+			},
+			Result: CR{
+				"error": "field id does not match id",
+			},
+		},
+		// одно и то же decimal-значение, записанное по-разному, - тот же ключ
+		Case{
+			Path:   "/prices/1.5",
+			Method: http.MethodPut,
+			Body: CR{
+				"amount": "1.50",
+				"label":  "sale",
+			},
+			Result: CR{
+				"response": CR{
+					"updated": 1,
+				},
+			},
+		},
+		Case{
+			Path:   "/prices/1.5",
+			Method: http.MethodPut,
+			Status: http.StatusBadRequest,
+			Body: CR{
+				"amount": "1.51",
+				"label":  "sale",
+			},
+			Result: CR{
+				"error": "field amount does not match id",
+			},
+		},
+		Case{
+			Path:   "/items/3",
+			Method: http.MethodPost,
+			Status: http.StatusMethodNotAllowed,
+			Result: CR{
+				"error": "method not allowed",
+			},
+		},
+		Case{
+			Path:   "/items",
+			Query:  "pk.id=3",
+			Method: http.MethodPost,
+			Status: http.StatusMethodNotAllowed,
+			Body: CR{
+				"title":       "rest",
+				"description": "",
+			},
+			Result: CR{
+				"error": "method not allowed",
+			},
+		},
+		Case{
+			Path:   "/items/",
+			Method: http.MethodPut,
+			Status: http.StatusMethodNotAllowed,
+			Result: CR{
+				"error": "method not allowed",
+			},
+		},
+	}
+
+	runCases(t, ts, db, cases)
+}
+
+func TestPatch(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	if err != nil {
+		panic(err)
+	}
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	PrepareTestApis(db)
+	defer CleanupTestApis(db)
+
+	handler, err := NewDbExplorer(db)
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(handler)
+
+	cases := []Case{
+		Case{
+			Path:        "/items/1",
+			Method:      http.MethodPatch,
+			ContentType: "application/merge-patch+json",
+			Body: CR{
+				"updated": nil,
+			},
+			Result: CR{
+				"response": CR{
+					"updated": 1,
+				},
+			},
+		},
+		Case{
+			Path:        "/items/1",
+			Method:      http.MethodPatch,
+			ContentType: "application/json-patch+json",
+			Body: []CR{
+				CR{"op": "test", "path": "/updated", "value": nil},
+				CR{"op": "copy", "from": "/title", "path": "/updated"},
+				CR{"op": "replace", "path": "/title", "value": "sql"},
+			},
+			Result: CR{
+				"response": CR{
+					"updated": 1,
+				},
+			},
+		},
+		Case{
+			Path: "/items/1",
+			Result: CR{
+				"response": CR{
+					"record": CR{
+						"id":          1,
+						"title":       "sql",
+						"description": "Рассказать про базы данных",
+						"updated":     "database/sql",
+					},
+				},
+			},
+		},
+		Case{
+			Path:        "/items/1",
+			Method:      http.MethodPatch,
+			ContentType: "application/json-patch+json",
+			Status:      http.StatusConflict,
+			Body: []CR{
+				CR{"op": "test", "path": "/title", "value": "database/sql"},
+				CR{"op": "replace", "path": "/title", "value": "memcache"},
+			},
+			Result: CR{
+				"error": "patch test failed",
+			},
+		},
+		Case{
+			Path:        "/items/1",
+			Method:      http.MethodPatch,
+			ContentType: "application/json-patch+json",
+			Status:      http.StatusBadRequest,
+			Body: []CR{
+				CR{"op": "replace", "path": "/id", "value": 2},
+			},
+			Result: CR{
+				"error": "field id have invalid type",
+			},
+		},
+		// copy читает исходное значение, даже если колонку до этого переместили
+		Case{
+			Path:        "/items/1",
+			Method:      http.MethodPatch,
+			ContentType: "application/json-patch+json",
+			Body: []CR{
+				CR{"op": "move", "from": "/updated", "path": "/description"},
+				CR{"op": "copy", "from": "/description", "path": "/title"},
+			},
+			Result: CR{
+				"response": CR{
+					"updated": 1,
+				},
+			},
+		},
+		Case{
+			Path: "/items/1",
+			Result: CR{
+				"response": CR{
+					"record": CR{
+						"id":          1,
+						"title":       "database/sql",
+						"description": "database/sql",
+						"updated":     nil,
+					},
+				},
+			},
+		},
+		// колонки ссылаются друг на друга по кругу - одним UPDATE не выразить
+		Case{
+			Path:        "/items/2",
+			Method:      http.MethodPatch,
+			ContentType: "application/json-patch+json",
+			Status:      http.StatusBadRequest,
+			Body: []CR{
+				CR{"op": "copy", "from": "/title", "path": "/updated"},
+				CR{"op": "copy", "from": "/description", "path": "/title"},
+				CR{"op": "copy", "from": "/updated", "path": "/description"},
+			},
+			Result: CR{
+				"error": "patch cannot be applied in one update",
+			},
+		},
+	}
+
+	runCases(t, ts, db, cases)
+}
+
+func TestETags(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	if err != nil {
+		panic(err)
+	}
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	PrepareTestApis(db)
+	defer CleanupTestApis(db)
+
+	handler, err := NewDbExplorer(db)
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(handler)
+
+	do := func(method, path, body string, header map[string]string) *http.Response {
+		req, _ := http.NewRequest(method, ts.URL+path, bytes.NewReader([]byte(body)))
+		req.Header.Add("Content-Type", "application/json")
+		for name, value := range header {
+			req.Header.Add(name, value)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("[%s %s] request error: %v", method, path, err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp
+	}
+	expectStatus := func(resp *http.Response, status int) {
+		if resp.StatusCode != status {
+			t.Fatalf("[%s %s] expected http status %v, got %v", resp.Request.Method, resp.Request.URL.Path, status, resp.StatusCode)
+		}
+	}
+
+	resp := do(http.MethodGet, "/items/1", "", nil)
+	expectStatus(resp, http.StatusOK)
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		t.Fatalf("expected ETag for record")
+	}
+	expectStatus(do(http.MethodGet, "/items/1", "", map[string]string{"If-None-Match": etag}), http.StatusNotModified)
+
+	list := do(http.MethodGet, "/items", "", nil)
+	expectStatus(list, http.StatusOK)
+	expectStatus(do(http.MethodGet, "/items", "", map[string]string{"If-None-Match": list.Header.Get("ETag")}), http.StatusNotModified)
+
+	expectStatus(do(http.MethodPost, "/items/1", `{"updated": "agent1"}`, map[string]string{"If-Match": `"stale"`}), http.StatusPreconditionFailed)
+	expectStatus(do(http.MethodPost, "/items/1", `{"updated": "agent1"}`, map[string]string{"If-Match": etag}), http.StatusOK)
+	// второй агент со старым ETag не перезаписывает чужое изменение
+	expectStatus(do(http.MethodPost, "/items/1", `{"updated": "agent2"}`, map[string]string{"If-Match": etag}), http.StatusPreconditionFailed)
+	expectStatus(do(http.MethodGet, "/items/1", "", map[string]string{"If-None-Match": etag}), http.StatusOK)
+	expectStatus(do(http.MethodDelete, "/items/1", "", map[string]string{"If-Match": etag}), http.StatusPreconditionFailed)
+
+	// ETag строки из списка совпадает с ETag записи и годится для If-Match
+	resp = do(http.MethodGet, "/items/2", "", nil)
+	expectStatus(resp, http.StatusOK)
+	etag = resp.Header.Get("ETag")
+	listResp, err := client.Get(ts.URL + "/items?etag=1&fields=id&limit=2&offset=1")
+	if err != nil {
+		t.Fatalf("list request error: %v", err)
+	}
+	var listed struct {
+		Response struct {
+			Records []map[string]interface{} `json:"records"`
+		} `json:"response"`
+	}
+	err = json.NewDecoder(listResp.Body).Decode(&listed)
+	listResp.Body.Close()
+	if err != nil || len(listed.Response.Records) != 1 {
+		t.Fatalf("unexpected list response: %v %v", listed, err)
+	}
+	if listed.Response.Records[0]["_etag"] != etag {
+		t.Fatalf("expected _etag %s in list, got %v", etag, listed.Response.Records[0]["_etag"])
+	}
+	if _, ok := listed.Response.Records[0]["__etag"]; ok {
+		t.Fatalf("internal __etag column leaked into list")
+	}
+	expectStatus(do(http.MethodPost, "/items/2", `{"updated": "grid"}`, map[string]string{"If-Match": etag}), http.StatusOK)
+}
+
+func TestBulkInsert(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	if err != nil {
+		panic(err)
+	}
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	PrepareTestApis(db)
+	defer CleanupTestApis(db)
+
+	handler, err := NewDbExplorer(db)
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(handler)
+
+	tooMany := make([]CR, maxBulkRows+1)
+	for i := range tooMany {
+		tooMany[i] = CR{"title": "bulk", "description": ""}
+	}
+
+	cases := []Case{
+		Case{
+			Path:   "/items/",
+			Method: http.MethodPut,
+			Status: http.StatusRequestEntityTooLarge,
+			Body:   tooMany,
+			Result: CR{
+				"error": "too many rows, limit is 10000",
+			},
+		},
+		Case{
+			Path:   "/items/",
+			Method: http.MethodPut,
+			Status: http.StatusCreated,
+			Body: []CR{
+				CR{"title": "bulk 1", "description": ""},
+				CR{"title": "bulk 2", "description": "", "updated": "rvasily"},
+			},
+			Result: CR{
+				"response": CR{
+					"inserted": 2,
+					"failed":   0,
+					"records": []CR{
+						CR{"index": 0, "key": CR{"id": 3}},
+						CR{"index": 1, "key": CR{"id": 4}},
+					},
+				},
+			},
+		},
+		// всё или ничего: одна плохая строка - не вставляется ни одна
+		Case{
+			Path:   "/items/",
+			Method: http.MethodPut,
+			Status: http.StatusBadRequest,
+			Body: []CR{
+				CR{"title": "bulk 3", "description": ""},
+				CR{"title": 42, "description": ""},
+			},
+			Result: CR{
+				"error": "row 1: field title have invalid type",
+			},
+		},
+		// строка, которая не объект, - ошибка этой строки, а не запись из одних DEFAULT
+		Case{
+			Path:   "/items/",
+			Method: http.MethodPut,
+			Status: http.StatusBadRequest,
+			Body: []interface{}{
+				CR{"title": "bulk 3", "description": ""},
+				nil,
+			},
+			Result: CR{
+				"error": "row 1: invalid json body",
+			},
+		},
+		Case{
+			Path:        "/items/",
+			Method:      http.MethodPut,
+			Status:      http.StatusBadRequest,
+			ContentType: "application/x-ndjson",
+			Body:        nil, // одна строка null
+			Result: CR{
+				"error": "row 0: invalid json body",
+			},
+		},
+		Case{
+			Path:   "/items/?mode=best_effort",
+			Method: http.MethodPut,
+			Body: []interface{}{
+				CR{"title": "bulk 3", "description": ""},
+				CR{"description": ""},
+				nil,
+			},
+			Result: CR{
+				"response": CR{
+					"inserted": 1,
+					"failed":   2,
+					"records": []CR{
+						CR{"index": 0, "key": CR{"id": 5}},
+						CR{
+							"index": 1,
+							"error": "field title is required",
+							"code":  "validation_failed",
+							"details": []CR{
+								CR{"field": "title", "code": "required", "message": "field title is required"},
+							},
+						},
+						CR{"index": 2, "error": "invalid json body", "code": "bad_request"},
+					},
+				},
+			},
+		},
+		Case{
+			Path:  "/items",
+			Query: "fields=id&limit=10",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{"id": 1},
+						CR{"id": 2},
+						CR{"id": 3},
+						CR{"id": 4},
+						CR{"id": 5},
+					},
+				},
+			},
+		},
+	}
+
+	runCases(t, ts, db, cases)
+}
+
+func TestFilterWrites(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	if err != nil {
+		panic(err)
+	}
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	PrepareTestApis(db)
+	defer CleanupTestApis(db)
+
+	handler, err := NewDbExplorer(db, WithMaxAffectedRows(1))
+	if err != nil {
+		panic(err)
+	}
+	if _, err := NewDbExplorer(db, WithMaxAffectedRows(0)); err == nil {
+		t.Error("expected error for WithMaxAffectedRows(0)")
+	}
+
+	ts := httptest.NewServer(handler)
+
+	cases := []Case{
+		// без фильтра всю таблицу не трогаем
+		Case{
+			Path:   "/items",
+			Method: http.MethodDelete,
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "filter is required",
+			},
+		},
+		Case{
+			Path:   "/items",
+			Query:  "filter.foo.eq=1",
+			Method: http.MethodDelete,
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "unknown filter column foo",
+			},
+		},
+		Case{
+			Path:   "/items",
+			Query:  "filter.id.gte=1&dry_run=1",
+			Method: http.MethodPatch,
+			Body: CR{
+				"updated": "rvasily",
+			},
+			Result: CR{
+				"response": CR{
+					"matched": 2,
+					"dry_run": true,
+				},
+			},
+		},
+		// под фильтр попадает больше строк, чем разрешено
+		Case{
+			Path:   "/items",
+			Query:  "filter.id.gte=1",
+			Method: http.MethodPatch,
+			Status: http.StatusBadRequest,
+			Body: CR{
+				"updated": "rvasily",
+			},
+			Result: CR{
+				"error": "filter matches more than 1 rows",
+			},
+		},
+		Case{
+			Path:   "/items",
+			Query:  "filter.updated.null=true",
+			Method: http.MethodPatch,
+			Status: http.StatusBadRequest,
+			Body: CR{
+				"title": 42,
+			},
+			Result: CR{
+				"error": "field title have invalid type",
+			},
+		},
+		Case{
+			Path:   "/items",
+			Query:  "filter.updated.null=true",
+			Method: http.MethodPatch,
+			Body: CR{
+				"updated": "rvasily",
+			},
+			Result: CR{
+				"response": CR{
+					"matched": 1,
+					"updated": 1,
+				},
+			},
+		},
+		Case{
+			Path:   "/items",
+			Query:  "filter.id.eq=2&dry_run=1",
+			Method: http.MethodDelete,
+			Result: CR{
+				"response": CR{
+					"matched": 1,
+					"dry_run": true,
+				},
+			},
+		},
+		Case{
+			Path:   "/items",
+			Query:  "filter.id.eq=2",
+			Method: http.MethodDelete,
+			Result: CR{
+				"response": CR{
+					"matched": 1,
+					"deleted": 1,
+				},
+			},
+		},
+		Case{
+			Path:  "/items",
+			Query: "fields=id,updated",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{"id": 1, "updated": "rvasily"},
+					},
+				},
+			},
+		},
+	}
+
+	runCases(t, ts, db, cases)
+}
+
+func TestBatch(t *testing.T) {
+	db, err := sql.Open("mysql", DSN)
+	if err != nil {
+		panic(err)
+	}
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	PrepareTestApis(db)
+	defer CleanupTestApis(db)
+
+	handler, err := NewDbExplorer(db)
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(handler)
+
+	cases := []Case{
+		Case{
+			Path:   "/_batch",
+			Method: http.MethodPost,
+			Body: CR{
+				"operations": []CR{
+					CR{"op": "create", "table": "items", "as": "item", "body": CR{"title": "batch", "description": ""}},
+					CR{"op": "update", "table": "items", "id": CR{"$ref": "item.id"}, "body": CR{"updated": "rvasily"}},
+					CR{"op": "delete", "table": "items", "id": 2},
+				},
+			},
+			Result: CR{
+				"response": CR{
+					"results": []CR{
+						CR{"id": 3},
+						CR{"updated": 1},
+						CR{"deleted": 1},
+					},
+				},
+			},
+		},
+		Case{
+			Path:  "/items",
+			Query: "fields=id,updated",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{"id": 1, "updated": "rvasily"},
+						CR{"id": 3, "updated": "rvasily"},
+					},
+				},
+			},
+		},
+		// ошибка во второй операции откатывает первую
+		Case{
+			Path:   "/_batch",
+			Method: http.MethodPost,
+			Status: http.StatusNotFound,
+			Body: CR{
+				"operations": []CR{
+					CR{"op": "delete", "table": "items", "id": 1},
+					CR{"op": "update", "table": "items", "id": 42, "body": CR{"updated": "rvasily"}},
+				},
+			},
+			Result: CR{
+				"error": "operation 1: record not found",
+			},
+		},
+		Case{
+			Path:   "/_batch",
+			Method: http.MethodPost,
+			Status: http.StatusBadRequest,
+			Body: CR{
+				"operations": []CR{
+					CR{"op": "delete", "table": "items", "id": 1},
+					CR{"op": "create", "table": "items", "body": CR{"title": CR{"$ref": "order.id"}}},
+				},
+			},
+			Result: CR{
+				"error": "operation 1: unknown reference order.id",
+			},
+		},
+		Case{
+			Path:   "/_batch",
+			Method: http.MethodPost,
+			Status: http.StatusBadRequest,
+			Body: CR{
+				"operations": []CR{
+					CR{"op": "create", "table": "items", "body": CR{"title": 42}},
+				},
+			},
+			Result: CR{
+				"error": "operation 0: field title have invalid type",
+			},
+		},
+		Case{
+			Path:  "/items",
+			Query: "fields=id",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{"id": 1},
+						CR{"id": 3},
+					},
+				},
+			},
+		},
+		Case{
+			Path:   "/_batch",
+			Status: http.StatusMethodNotAllowed,
+			Result: CR{
+				"error": "method not allowed",
+			},
+		},
+	}
+
+	runCases(t, ts, db, cases)
+}
@@ -0,0 +1,513 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// документ OpenAPI 3 собирается из текущей схемы на каждый запрос:
+// после /_reload он сразу описывает новые таблицы
+
+type object = map[string]interface{}
+
+// filterOperators - операторы фильтра, которые описываем в параметрах списка
+func filterOperators() []string {
+	return []string{"eq", "ne", "lt", "lte", "gt", "gte", "like", "in", "between", "null"}
+}
+
+// componentName - имя схемы в components, допустимое для OpenAPI
+func componentName(schema *Schema, table *Table) string {
+	return strings.ReplaceAll(schema.RouteName(table), "/", ".")
+}
+
+// openAPIColumn - схема значения колонки в ответе и в теле запроса.
+// Строится из той же columnJSONSchema, по которой сервер проверяет тело.
+func openAPIColumn(column *Column) object {
+	return openAPISchema(columnJSONSchema(column))
+}
+
+// openAPIKeywordType - к какому типу относится ключевое слово, пусто - к любому
+func openAPIKeywordType(keyword string) []string {
+	switch keyword {
+	case "pattern", "format", "maxLength":
+		return []string{"string"}
+	case "items":
+		return []string{"array"}
+	case "minimum", "maximum":
+		return []string{"integer", "number"}
+	}
+	return nil
+}
+
+// openAPISchema переводит схему колонки из JSON Schema 2020-12 в диалект OpenAPI 3.0:
+// "null" в type превращается в nullable, несколько типов - в oneOf,
+// contentEncoding base64 - в format byte
+func openAPISchema(schema object) object {
+	res := object{}
+	for keyword, value := range schema {
+		res[keyword] = value
+	}
+	if res["contentEncoding"] == "base64" {
+		delete(res, "contentEncoding")
+		res["format"] = "byte"
+	}
+	if items, ok := res["items"].(object); ok {
+		res["items"] = openAPISchema(items)
+	}
+
+	var types []string
+	switch t := res["type"].(type) {
+	case string:
+		types = []string{t}
+	case []string:
+		types = t
+	}
+	if len(types) == 0 {
+		return res // json-колонка или {"not": {}}
+	}
+	delete(res, "type")
+	nonNull := make([]string, 0, len(types))
+	for _, name := range types {
+		if name == "null" {
+			res["nullable"] = true
+		} else {
+			nonNull = append(nonNull, name)
+		}
+	}
+	if len(nonNull) == 1 {
+		res["type"] = nonNull[0]
+		return res
+	}
+
+	// несколько типов: ключевые слова, относящиеся к одному типу, уходят в его ветку oneOf
+	branches := make([]interface{}, 0, len(nonNull))
+	for _, name := range nonNull {
+		branch := object{"type": name}
+		for keyword, value := range res {
+			if Contains(openAPIKeywordType(keyword), name) {
+				branch[keyword] = value
+			}
+		}
+		branches = append(branches, branch)
+	}
+	for keyword := range res {
+		if openAPIKeywordType(keyword) != nil {
+			delete(res, keyword)
+		}
+	}
+	res["oneOf"] = branches
+	return res
+}
+
+func openAPIRecord(table *Table) object {
+	properties := object{}
+	for _, column := range table.Columns {
+		properties[column.Name] = openAPIColumn(column)
+	}
+	return object{"type": "object", "properties": properties}
+}
+
+// openAPIInput - тело вставки и замены (обязательны NOT NULL колонки без default) и частичного обновления
+func openAPIInput(table *Table, payload string) object {
+	properties := object{}
+	required := make([]string, 0)
+	for _, column := range table.Columns {
+		if table.IsPrimaryKey(column.Name) && (payload != payloadInsert || column.AutoIncrement) {
+			continue // ключ не меняется, auto increment при вставке игнорируется
+		}
+		properties[column.Name] = openAPIColumn(column)
+		if payload != payloadUpdate && !column.IsNullable && !column.Default.Valid && !column.AutoIncrement {
+			required = append(required, column.Name)
+		}
+	}
+	res := object{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		res["required"] = required
+	}
+	return res
+}
+
+func ref(name string) object {
+	return object{"$ref": "#/components/schemas/" + name}
+}
+
+// envelope - ответ api всегда обёрнут в {"response": ...}
+func envelope(description string, properties object) object {
+	return object{
+		"description": description,
+		"content": object{
+			"application/json": object{
+				"schema": object{
+					"type": "object",
+					"properties": object{
+						"response": object{"type": "object", "properties": properties},
+					},
+				},
+			},
+		},
+	}
+}
+
+func errorResponses(codes ...int) object {
+	res := object{}
+	for _, code := range codes {
+		res[fmt.Sprint(code)] = object{"$ref": fmt.Sprintf("#/components/responses/Error%d", code)}
+	}
+	return res
+}
+
+func withErrors(responses object, codes ...int) object {
+	for code, response := range errorResponses(codes...) {
+		responses[code] = response
+	}
+	return responses
+}
+
+func queryParam(name, description string, schema object) object {
+	return object{"name": name, "in": "query", "description": description, "schema": schema}
+}
+
+func listParameters(table *Table) []interface{} {
+	params := []interface{}{
+		queryParam("limit", fmt.Sprintf("строк на странице, по умолчанию %d, не больше %d", defaultLimit, maxLimit), object{"type": "integer"}),
+		queryParam("offset", "смещение от начала выборки", object{"type": "integer"}),
+		queryParam("sort", "колонки через запятую, минус - по убыванию", object{"type": "string"}),
+		queryParam("fields", "колонки через запятую, первичный ключ добавляется всегда", object{"type": "string"}),
+		queryParam("cursor", "курсор next/prev из предыдущего ответа, пустой - первая страница", object{"type": "string"}),
+		queryParam("total", "посчитать общее число строк", object{"type": "string", "enum": []string{"exact", "estimate"}}),
+		queryParam("meta", "добавить описание колонок и страницы", object{"type": "boolean"}),
+		queryParam("etag", "добавить в каждую запись _etag - ETag строки для If-Match", object{"type": "boolean"}),
+	}
+	return append(params, filterParameters(table)...)
+}
+
+// filterParameters - параметры filter.$column.$op для каждой колонки
+func filterParameters(table *Table) []interface{} {
+	params := make([]interface{}, 0, len(table.Columns)*len(filterOperators()))
+	for _, column := range table.Columns {
+		for _, operator := range filterOperators() {
+			schema := object{"type": "string"}
+			if operator == "null" {
+				schema = object{"type": "boolean"}
+			}
+			params = append(params, queryParam(filterParamPrefix+column.Name+"."+operator, "", schema))
+		}
+	}
+	return params
+}
+
+func (exp *DbExplorer) openAPIDocument() object {
+	schema := exp.getSchema()
+	paths := object{}
+	schemas := object{
+		"Error": object{
+			"type":     "object",
+			"required": []string{"error"},
+			"properties": object{
+				"error": object{"type": "string"},
+			},
+		},
+		"JSONPatch": object{
+			"type": "array",
+			"items": object{
+				"type":     "object",
+				"required": []string{"op", "path"},
+				"properties": object{
+					"op":    object{"type": "string", "enum": []string{"add", "remove", "replace", "copy", "move", "test"}},
+					"path":  object{"type": "string", "description": "/$column"},
+					"from":  object{"type": "string"},
+					"value": object{},
+				},
+			},
+		},
+		// ответ при Accept: application/problem+json
+		"Problem": object{
+			"type":     "object",
+			"required": []string{"type", "title", "status", "code", "detail"},
+			"properties": object{
+				"type":   object{"type": "string"},
+				"title":  object{"type": "string"},
+				"status": object{"type": "integer"},
+				"code":   object{"type": "string"},
+				"detail": object{"type": "string"},
+				"field":  object{"type": "string"},
+				"details": object{
+					"type": "array",
+					"items": object{
+						"type":     "object",
+						"required": []string{"field", "code", "message"},
+						"properties": object{
+							"field":   object{"type": "string"},
+							"code":    object{"type": "string"},
+							"message": object{"type": "string"},
+						},
+					},
+				},
+				"request_id": object{"type": "string"},
+			},
+		},
+	}
+
+	tables := make([]*Table, 0)
+	for _, databaseTables := range schema.Databases {
+		for _, table := range databaseTables {
+			tables = append(tables, table)
+		}
+	}
+	sort.Slice(tables, func(i, j int) bool {
+		return schema.RouteName(tables[i]) < schema.RouteName(tables[j])
+	})
+
+	for _, table := range tables {
+		name := componentName(schema, table)
+		route := "/" + schema.RouteName(table)
+		schemas[name] = openAPIRecord(table)
+		schemas[name+".create"] = openAPIInput(table, payloadInsert)
+		schemas[name+".update"] = openAPIInput(table, payloadUpdate)
+		if exp.routing == RESTfulRouting {
+			schemas[name+".replace"] = openAPIInput(table, payloadReplace)
+		}
+
+		listProperties := object{
+			"records": object{"type": "array", "items": ref(name)},
+			"next":    object{"type": "string"},
+			"prev":    object{"type": "string"},
+			"page":    object{"type": "object"},
+			"columns": object{"type": "array", "items": object{"type": "object"}},
+		}
+		collection := object{
+			"get": object{
+				"operationId": "list." + name,
+				"parameters":  listParameters(table),
+				"responses":   withErrors(object{"200": envelope("записи", listProperties)}, 400, 404, 409, 500),
+			},
+		}
+		if len(table.PrimaryKey) > 0 {
+			keyProperties := object{}
+			for _, key := range table.PrimaryKey {
+				column, _ := table.Column(key)
+				keyProperties[key] = openAPIColumn(column)
+			}
+			created := envelope("ключ новой записи", keyProperties)
+			created["headers"] = object{
+				"Location": object{"description": "путь к новой записи", "schema": object{"type": "string"}},
+			}
+			create, _ := exp.writeMethods()
+			bulk := object{
+				"inserted": object{"type": "integer"},
+				"failed":   object{"type": "integer"},
+				"records":  object{"type": "array", "items": object{"type": "object"}},
+			}
+			collection[strings.ToLower(create)] = object{
+				"operationId": "create." + name,
+				"parameters": []interface{}{
+					queryParam("mode", "для массовой вставки: всё или ничего либо всё, что удалось", object{"type": "string", "enum": []string{bulkModeAtomic, bulkModeBestEffort}}),
+				},
+				"requestBody": object{
+					"required": true,
+					"content": object{
+						"application/json": object{"schema": object{"oneOf": []interface{}{
+							ref(name + ".create"),
+							object{"type": "array", "items": ref(name + ".create")},
+						}}},
+						"application/x-ndjson": object{"schema": ref(name + ".create")},
+					},
+				},
+				"responses": withErrors(object{
+					"201": created,
+					"200": envelope("массовая вставка с ошибками в части строк (best_effort)", bulk),
+				}, 400, 404, 409, 422, 500),
+			}
+
+			// изменение и удаление по фильтру, фильтр обязателен
+			whereParameters := append([]interface{}{
+				queryParam("dry_run", "только посчитать подходящие строки", object{"type": "boolean"}),
+			}, filterParameters(table)...)
+			collection["patch"] = object{
+				"operationId": "updateWhere." + name,
+				"parameters":  whereParameters,
+				"requestBody": object{
+					"required": true,
+					"content":  object{"application/json": object{"schema": ref(name + ".update")}},
+				},
+				"responses": withErrors(object{"200": envelope("обновлено", object{
+					"matched": object{"type": "integer"},
+					"updated": object{"type": "integer"},
+					"dry_run": object{"type": "boolean"},
+				})}, 400, 404, 409, 422, 500),
+			}
+			collection["delete"] = object{
+				"operationId": "deleteWhere." + name,
+				"parameters":  whereParameters,
+				"responses": withErrors(object{"200": envelope("удалено", object{
+					"matched": object{"type": "integer"},
+					"deleted": object{"type": "integer"},
+					"dry_run": object{"type": "boolean"},
+				})}, 400, 404, 409, 500),
+			}
+
+			idParam := object{
+				"name":        "id",
+				"in":          "path",
+				"required":    true,
+				"description": "значения ключа " + strings.Join(table.PrimaryKey, ",") + " через запятую",
+				"schema":      object{"type": "string"},
+			}
+			record := object{
+				"parameters": []interface{}{
+					idParam,
+					object{"name": "If-Match", "in": "header", "description": "ETag записи, при несовпадении - 412", "schema": object{"type": "string"}},
+					object{"name": "If-None-Match", "in": "header", "description": "ETag записи, при совпадении GET отвечает 304", "schema": object{"type": "string"}},
+				},
+				"get": object{
+					"operationId": "get." + name,
+					"parameters": []interface{}{
+						queryParam("fields", "колонки через запятую", object{"type": "string"}),
+					},
+					"responses": withErrors(object{
+						"200": envelope("запись", object{"record": ref(name)}),
+						"304": object{"description": "запись не изменилась"},
+					}, 400, 404, 500),
+				},
+				"delete": object{
+					"operationId": "delete." + name,
+					"responses":   withErrors(object{"200": envelope("удалено", object{"deleted": object{"type": "integer"}})}, 400, 404, 409, 412, 500),
+				},
+			}
+			record["patch"] = object{
+				"operationId": "patch." + name,
+				"requestBody": object{
+					"required": true,
+					"content": object{
+						"application/json":    object{"schema": ref(name + ".update")},
+						mergePatchContentType: object{"schema": ref(name + ".update")},
+						jsonPatchContentType:  object{"schema": ref("JSONPatch")},
+					},
+				},
+				"responses": withErrors(object{"200": envelope("обновлено", object{"updated": object{"type": "integer"}})}, 400, 404, 409, 412, 422, 500),
+			}
+			if exp.routing == RESTfulRouting {
+				record["put"] = object{
+					"operationId": "replace." + name,
+					"requestBody": object{
+						"required": true,
+						"content":  object{"application/json": object{"schema": ref(name + ".replace")}},
+					},
+					"responses": withErrors(object{"200": envelope("заменено", object{"updated": object{"type": "integer"}})}, 400, 404, 409, 412, 422, 500),
+				}
+			} else {
+				record["post"] = object{
+					"operationId": "update." + name,
+					"requestBody": object{
+						"required": true,
+						"content":  object{"application/json": object{"schema": ref(name + ".update")}},
+					},
+					"responses": withErrors(object{"200": envelope("обновлено", object{"updated": object{"type": "integer"}})}, 400, 404, 409, 412, 422, 500),
+				}
+			}
+			paths[route+"/{id}"] = record
+		}
+		paths[route] = collection
+		paths[route+"/"+schemaSegment] = object{
+			"get": object{
+				"operationId": "schema." + name,
+				"responses":   withErrors(object{"200": envelope("описание таблицы", object{"schema": object{"type": "object"}})}, 404),
+			},
+		}
+		for _, payload := range []string{payloadInsert, payloadUpdate, payloadReplace} {
+			paths[route+"/"+schemaSegment+"/"+payload] = object{
+				"get": object{
+					"operationId": "schema." + payload + "." + name,
+					"responses": withErrors(object{"200": object{
+						"description": "JSON Schema (draft 2020-12) тела запроса",
+						"content":     object{"application/schema+json": object{"schema": object{"type": "object"}}},
+					}}, 404),
+				},
+			}
+		}
+	}
+
+	paths["/"] = object{
+		"get": object{
+			"operationId": "tables",
+			"responses": withErrors(object{"200": envelope("список таблиц", object{
+				"tables":    object{"type": "array", "items": object{"type": "string"}},
+				"databases": object{"type": "object"},
+				"info":      object{"type": "object"},
+			})}, 500),
+		},
+	}
+
+	paths["/_batch"] = object{
+		"post": object{
+			"operationId": "batch",
+			"description": "операции в одной транзакции, {\"$ref\": \"$name.$field\"} - результат предыдущей операции",
+			"requestBody": object{
+				"required": true,
+				"content": object{"application/json": object{"schema": object{
+					"type":     "object",
+					"required": []string{"operations"},
+					"properties": object{
+						"operations": object{
+							"type": "array",
+							"items": object{
+								"type":     "object",
+								"required": []string{"op", "table"},
+								"properties": object{
+									"op":    object{"type": "string", "enum": []string{batchCreate, batchUpdate, batchDelete}},
+									"table": object{"type": "string"},
+									"id":    object{},
+									"body":  object{"type": "object"},
+									"as":    object{"type": "string"},
+								},
+							},
+						},
+					},
+				}}},
+			},
+			"responses": withErrors(object{"200": envelope("результаты операций по порядку", object{
+				"results": object{"type": "array", "items": object{"type": "object"}},
+			})}, 400, 404, 409, 422, 500),
+		},
+	}
+
+	responses := object{}
+	for _, code := range []int{400, 404, 409, 412, 422, 500} {
+		responses[fmt.Sprintf("Error%d", code)] = object{
+			"description": http.StatusText(code),
+			"headers": object{
+				requestIDHeader: object{"schema": object{"type": "string"}},
+			},
+			"content": object{
+				"application/json": object{"schema": ref("Error")},
+				problemContentType: object{"schema": ref("Problem")},
+			},
+		}
+	}
+
+	return object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":   "db_explorer",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": object{
+			"schemas":   schemas,
+			"responses": responses,
+		},
+	}
+}
+
+// openAPIFunc отдаёт документ как есть, без обёртки {"response": ...}
+func (exp *DbExplorer) openAPIFunc(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	json.NewEncoder(w).Encode(exp.openAPIDocument())
+}
@@ -0,0 +1,91 @@
+package main
+
+import "strings"
+
+// Option - настройка DbExplorer, передаётся в NewDbExplorer
+type Option func(*DbExplorer)
+
+// RoutingMode - какими http-методами создаются и меняются записи
+type RoutingMode int
+
+const (
+	// LegacyRouting - PUT /$table создаёт запись, POST /$table/$id обновляет
+	LegacyRouting RoutingMode = iota
+	// RESTfulRouting - POST /$table создаёт, PUT /$table/$id заменяет целиком, PATCH /$table/$id обновляет часть полей
+	RESTfulRouting
+)
+
+// WithRouting выбирает режим маршрутизации, по умолчанию LegacyRouting
+func WithRouting(mode RoutingMode) Option {
+	return func(exp *DbExplorer) {
+		exp.routing = mode
+	}
+}
+
+// WithReloadEndpoint включает POST /_reload. По умолчанию он выключен: перечитывание
+// схемы - это полный обход information_schema, и звать его должен только админ.
+// Метод Reload доступен всегда.
+func WithReloadEndpoint() Option {
+	return func(exp *DbExplorer) {
+		exp.reloadEndpoint = true
+	}
+}
+
+// WithMaxAffectedRows - сколько строк можно изменить или удалить одним запросом по фильтру,
+// по умолчанию 1000. Не больше нуля - NewDbExplorer вернёт ошибку
+func WithMaxAffectedRows(limit int) Option {
+	return func(exp *DbExplorer) {
+		exp.maxAffectedRows = limit
+	}
+}
+
+// visibility - какие базы и таблицы отдаём наружу.
+// Пустой allow - разрешено всё, deny проверяется после allow.
+type visibility struct {
+	allowSchemas []string
+	denySchemas  []string
+	allowTables  []string // имя таблицы или $database.$table
+	denyTables   []string
+}
+
+// WithSchemas ограничивает набор баз данных, доступных через api
+func WithSchemas(allow, deny []string) Option {
+	return func(exp *DbExplorer) {
+		exp.visibility.allowSchemas = allow
+		exp.visibility.denySchemas = deny
+	}
+}
+
+// WithTables ограничивает набор таблиц: table или database.table
+func WithTables(allow, deny []string) Option {
+	return func(exp *DbExplorer) {
+		exp.visibility.allowTables = allow
+		exp.visibility.denyTables = deny
+	}
+}
+
+func (v visibility) isExposed(databaseName, tableName string) bool {
+	if len(v.allowSchemas) > 0 && !Contains(v.allowSchemas, databaseName) {
+		return false
+	}
+	if Contains(v.denySchemas, databaseName) {
+		return false
+	}
+	if len(v.allowTables) > 0 && !matchTable(v.allowTables, databaseName, tableName) {
+		return false
+	}
+	return !matchTable(v.denyTables, databaseName, tableName)
+}
+
+func matchTable(patterns []string, databaseName, tableName string) bool {
+	for _, pattern := range patterns {
+		if database, table, ok := strings.Cut(pattern, "."); ok {
+			if database == databaseName && table == tableName {
+				return true
+			}
+		} else if pattern == tableName {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultLimit = 5
+	maxLimit     = 1000 // больше строк за один запрос не отдаём
+)
+
+// pageInfo - метаданные страницы в ответе списка (?meta=1 или ?total=...)
+type pageInfo struct {
+	Limit     int    `json:"limit"`
+	Offset    *int   `json:"offset,omitempty"` // в режиме курсора offset не используется
+	Total     *int64 `json:"total,omitempty"`
+	TotalType string `json:"total_type,omitempty"` // exact или estimate
+	Next      string `json:"next,omitempty"`
+	Prev      string `json:"prev,omitempty"`
+}
+
+func retrieveLimit(r *http.Request) int {
+	limit := retrieveParam(r.FormValue("limit"), defaultLimit)
+	if limit <= 0 {
+		return defaultLimit
+	}
+	if limit > maxLimit {
+		return maxLimit
+	}
+	return limit
+}
+
+func retrieveOffset(r *http.Request) int {
+	offset := retrieveParam(r.FormValue("offset"), 0)
+	if offset < 0 {
+		return 0
+	}
+	return offset
+}
+
+// pageLink - ссылка на ту же выборку с заменёнными параметрами
+func pageLink(r *http.Request, params map[string]string) string {
+	query := r.URL.Query()
+	for name, value := range params {
+		query.Set(name, value)
+	}
+	return r.URL.Path + "?" + query.Encode()
+}
+
+func offsetLinks(r *http.Request, page *pageInfo, offset, count int) {
+	hasNext := count == page.Limit
+	if page.Total != nil {
+		hasNext = int64(offset+page.Limit) < *page.Total
+	}
+	if hasNext {
+		page.Next = pageLink(r, map[string]string{"offset": strconv.Itoa(offset + page.Limit)})
+	}
+	if offset > 0 {
+		prev := offset - page.Limit
+		if prev < 0 {
+			prev = 0
+		}
+		page.Prev = pageLink(r, map[string]string{"offset": strconv.Itoa(prev)})
+	}
+}
+
+// countRecords считает строки: exact - COUNT(*) с учётом фильтра,
+// estimate - оценка из information_schema, для больших таблиц без фильтра
+func (exp *DbExplorer) countRecords(table *Table, filter Filter, totalType string) (int64, error) {
+	var total int64
+	switch totalType {
+	case "exact":
+		query := fmt.Sprintf("SELECT COUNT(*) FROM %s", table.FullName())
+		condition, args := filter.where()
+		if condition != "" {
+			query += " WHERE " + condition
+		}
+		if err := exp.db.QueryRow(query, args...).Scan(&total); err != nil {
+			return 0, DbError{statusCode: http.StatusInternalServerError, err: err}
+		}
+	case "estimate":
+		if len(filter) > 0 {
+			return 0, DbError{statusCode: http.StatusBadRequest, err: errors.New("estimate total is not available with filter")}
+		}
+		query := "SELECT COALESCE(TABLE_ROWS, 0) FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?"
+		if err := exp.db.QueryRow(query, table.Database, table.Name).Scan(&total); err != nil {
+			return 0, DbError{statusCode: http.StatusInternalServerError, err: err}
+		}
+	default:
+		return 0, DbError{statusCode: http.StatusBadRequest, err: errors.New("total must be exact or estimate")}
+	}
+	return total, nil
+}
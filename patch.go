@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// PATCH /$table/$id, смысл тела определяется по Content-Type:
+// application/json - переданные поля, null - NULL (как обычное обновление);
+// application/merge-patch+json (RFC 7386) - то же, но объект для json-колонки сливается с текущим значением;
+// application/json-patch+json (RFC 6902) - операции над колонками, test - условие на текущее значение.
+// Любой вариант превращается в один UPDATE.
+
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+)
+
+func (exp *DbExplorer) handlePatch(w http.ResponseWriter, r *http.Request, table *Table, segments []string) {
+	rawId, ok := recordSegment(r, segments)
+	if !ok && len(segments) == 0 {
+		exp.UpdateWhere(w, r, table)
+		return
+	}
+	if !ok {
+		HandleError(w, DbError{statusCode: http.StatusNotFound, err: errors.New("unknown method")})
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case mergePatchContentType:
+		exp.MergePatchRecord(w, r, table, rawId)
+	case jsonPatchContentType:
+		exp.JSONPatchRecord(w, r, table, rawId)
+	case "", "application/json":
+		exp.UpdateRecord(w, r, table, rawId)
+	default:
+		str := fmt.Sprintf("unsupported content type %s", mediaType)
+		HandleError(w, DbError{statusCode: http.StatusUnsupportedMediaType, err: errors.New(str)})
+	}
+}
+
+func (exp *DbExplorer) MergePatchRecord(w http.ResponseWriter, r *http.Request, table *Table, rawId string) {
+	key, err := table.parseRecordKey(rawId, r.URL.Query())
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+
+	body, err := jsonBodyParser(r.Body)
+	r.Body.Close()
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+
+	keys, values, err := exp.Validate(body, table, payloadUpdate)
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+
+	setValues := make([]string, 0, len(keys))
+	for _, name := range keys {
+		column, _ := table.Column(name)
+		if _, isObject := body[name].(map[string]interface{}); isObject && column.Kind == kindJSON {
+			// JSON_MERGE_PATCH в mysql реализует тот же RFC 7386
+			setValues = append(setValues, fmt.Sprintf("%s = JSON_MERGE_PATCH(COALESCE(%s, JSON_OBJECT()), ?)", quoteIdent(name), quoteIdent(name)))
+		} else {
+			setValues = append(setValues, quoteIdent(name)+" = ?")
+		}
+	}
+	affected, err := updateRow(exp.db, table, key, setValues, values, table.preconditions(r))
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+
+	data := make(map[string]int64, 1)
+	data["updated"] = affected
+	SendResponse(w, data)
+}
+
+// patchOperation - операция JSON Patch, path и from - /$column
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// patchAssignment - будущее значение колонки: литерал из патча или исходное значение другой колонки
+type patchAssignment struct {
+	value  interface{}
+	source string // колонка для copy/move, пусто - value
+	seq    int    // номер операции, задавшей значение
+}
+
+func parsePatch(body io.Reader) ([]patchOperation, error) {
+	ops := make([]patchOperation, 0)
+	if err := json.NewDecoder(body).Decode(&ops); err != nil {
+		return nil, DbError{statusCode: http.StatusBadRequest, err: errors.New("invalid json patch")}
+	}
+	return ops, nil
+}
+
+// patchValue разбирает value операции так же, как поля обычного тела запроса
+func (op patchOperation) patchValue() (interface{}, error) {
+	if len(op.Value) == 0 {
+		str := fmt.Sprintf("value is required for %s %s", op.Op, op.Path)
+		return nil, DbError{statusCode: http.StatusBadRequest, err: errors.New(str)}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(op.Value))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, DbError{statusCode: http.StatusBadRequest, err: errors.New("invalid json patch")}
+	}
+	if num, ok := value.(json.Number); ok {
+		value = convertNumber(num)
+	}
+	return value, nil
+}
+
+// patchColumn - колонка по JSON Pointer, поддерживаются только пути верхнего уровня.
+// Ключ можно только читать (test, from), менять его нельзя.
+func (t *Table) patchColumn(pointer string, writable bool) (*Column, error) {
+	name := strings.TrimPrefix(pointer, "/")
+	if !strings.HasPrefix(pointer, "/") || strings.Contains(name, "/") {
+		str := fmt.Sprintf("unsupported patch path %s", pointer)
+		return nil, DbError{statusCode: http.StatusBadRequest, err: errors.New(str)}
+	}
+	name = strings.ReplaceAll(strings.ReplaceAll(name, "~1", "/"), "~0", "~")
+	column, ok := t.Column(name)
+	if !ok {
+		str := fmt.Sprintf("unknown field %s", name)
+		return nil, DbError{statusCode: http.StatusBadRequest, err: errors.New(str)}
+	}
+	if writable && t.IsPrimaryKey(name) {
+		str := fmt.Sprintf("field %s have invalid type", name)
+		return nil, DbError{statusCode: http.StatusBadRequest, err: errors.New(str), code: "invalid_type", field: name}
+	}
+	return column, nil
+}
+
+// sameJSON - равенство значений по правилам JSON Patch test
+func sameJSON(a, b interface{}) bool {
+	dataA, errA := json.Marshal(a)
+	dataB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(dataA, dataB)
+}
+
+func (exp *DbExplorer) JSONPatchRecord(w http.ResponseWriter, r *http.Request, table *Table, rawId string) {
+	key, err := table.parseRecordKey(rawId, r.URL.Query())
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+
+	ops, err := parsePatch(r.Body)
+	r.Body.Close()
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+
+	pending := make(map[string]*patchAssignment)
+	conditions := make([]string, 0)
+	conditionArgs := make([]interface{}, 0)
+	// resolve - текущее значение колонки с учётом уже применённых операций
+	resolve := func(name string, seq int) *patchAssignment {
+		if assignment, ok := pending[name]; ok {
+			return &patchAssignment{value: assignment.value, source: assignment.source, seq: seq}
+		}
+		return &patchAssignment{source: name, seq: seq}
+	}
+
+	for seq, op := range ops {
+		column, err := table.patchColumn(op.Path, op.Op != "test")
+		if err != nil {
+			HandleError(w, err)
+			return
+		}
+		switch op.Op {
+		case "add", "replace":
+			value, err := op.patchValue()
+			if err != nil {
+				HandleError(w, err)
+				return
+			}
+			pending[column.Name] = &patchAssignment{value: value, seq: seq}
+		case "remove":
+			pending[column.Name] = &patchAssignment{value: nil, seq: seq}
+		case "copy", "move":
+			from, err := table.patchColumn(op.From, op.Op == "move")
+			if err != nil {
+				HandleError(w, err)
+				return
+			}
+			pending[column.Name] = resolve(from.Name, seq)
+			if op.Op == "move" && from.Name != column.Name {
+				pending[from.Name] = &patchAssignment{value: nil, seq: seq}
+			}
+		case "test":
+			value, err := op.patchValue()
+			if err != nil {
+				HandleError(w, err)
+				return
+			}
+			current := resolve(column.Name, seq)
+			if current.source == "" {
+				// колонка уже изменена патчем - сравниваем с новым значением сразу
+				if !sameJSON(current.value, value) {
+					HandleError(w, DbError{statusCode: http.StatusConflict, err: errors.New("patch test failed"), code: "test_failed"})
+					return
+				}
+				continue
+			}
+			source, _ := table.Column(current.source)
+			condition, args, ok := testCondition(source, value)
+			if !ok {
+				str := fmt.Sprintf("field %s have invalid type", column.Name)
+				HandleError(w, DbError{statusCode: http.StatusBadRequest, err: errors.New(str), code: "invalid_type", field: column.Name})
+				return
+			}
+			conditions = append(conditions, condition)
+			conditionArgs = append(conditionArgs, args...)
+		default:
+			str := fmt.Sprintf("unknown patch op %s", op.Op)
+			HandleError(w, DbError{statusCode: http.StatusBadRequest, err: errors.New(str)})
+			return
+		}
+	}
+
+	// литералы проверяем и приводим так же, как тело обычного обновления
+	body := make(map[string]interface{})
+	for name, assignment := range pending {
+		if assignment.source == "" {
+			body[name] = assignment.value
+		}
+	}
+	keys, values, err := exp.Validate(body, table, payloadUpdate)
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+	dbValues := make(map[string]interface{}, len(keys))
+	for i, name := range keys {
+		dbValues[name] = values[i]
+	}
+
+	names, err := assignmentOrder(pending)
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+	setValues := make([]string, 0, len(names))
+	args := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		if source := pending[name].source; source != "" {
+			setValues = append(setValues, quoteIdent(name)+" = "+quoteIdent(source))
+		} else {
+			setValues = append(setValues, quoteIdent(name)+" = ?")
+			args = append(args, dbValues[name])
+		}
+	}
+
+	failed := DbError{statusCode: http.StatusConflict, err: errors.New("patch test failed"), code: "test_failed"}
+	tests := make([]rowCondition, 0, 1)
+	if len(conditions) > 0 {
+		tests = append(tests, rowCondition{sql: strings.Join(conditions, " AND "), args: conditionArgs, err: failed})
+	}
+	affected, err := updateRow(exp.db, table, key, setValues, args, table.preconditions(r, tests...))
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+
+	data := make(map[string]int64, 1)
+	data["updated"] = affected
+	SendResponse(w, data)
+}
+
+// assignmentOrder - порядок колонок в SET. mysql выполняет присваивания слева направо
+// и видит уже присвоенные значения, а source всегда ссылается на исходное значение колонки,
+// поэтому колонку можно менять только после всех присваиваний, которые её читают.
+// Если так упорядочить нельзя (колонки ссылаются друг на друга по кругу) - 400.
+func assignmentOrder(pending map[string]*patchAssignment) ([]string, error) {
+	names := make([]string, 0, len(pending))
+	for name := range pending {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := pending[names[i]], pending[names[j]]
+		if a.seq != b.seq {
+			return a.seq < b.seq
+		}
+		return names[i] < names[j]
+	})
+
+	ordered := make([]string, 0, len(names))
+	done := make(map[string]bool, len(names))
+	// readersLeft - есть ли ещё не поставленное присваивание, которое читает колонку name
+	readersLeft := func(name string) bool {
+		for _, other := range names {
+			if !done[other] && other != name && pending[other].source == name {
+				return true
+			}
+		}
+		return false
+	}
+	for len(ordered) < len(names) {
+		next := ""
+		for _, name := range names {
+			if !done[name] && !readersLeft(name) {
+				next = name
+				break
+			}
+		}
+		if next == "" {
+			return nil, DbError{statusCode: http.StatusBadRequest, err: errors.New("patch cannot be applied in one update")}
+		}
+		ordered = append(ordered, next)
+		done[next] = true
+	}
+	return ordered, nil
+}
+
+// testCondition - условие "колонка равна value" для операции test
+func testCondition(column *Column, value interface{}) (string, []interface{}, bool) {
+	if value == nil {
+		return quoteIdent(column.Name) + " IS NULL", nil, true
+	}
+	dbValue, ok := column.toDbValue(value)
+	if !ok {
+		return "", nil, false
+	}
+	if column.Kind == kindJSON {
+		return quoteIdent(column.Name) + " = CAST(? AS JSON)", []interface{}{dbValue}, true
+	}
+	return quoteIdent(column.Name) + " = ?", []interface{}{dbValue}, true
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// префикс query-параметров для адресации записи: /$table?pk.user_id=1&pk.role_id=42
+const keyParamPrefix = "pk."
+
+// recordKey - значения первичного ключа в порядке table.PrimaryKey
+type recordKey []interface{}
+
+func hasKeyParams(params url.Values) bool {
+	for name := range params {
+		if strings.HasPrefix(name, keyParamPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRecordKey разбирает ключ записи либо из сегмента пути (1,42),
+// либо из параметров pk.$column, если сегмента нет
+func (t *Table) parseRecordKey(rawId string, params url.Values) (recordKey, error) {
+	if err := t.requirePrimaryKey(); err != nil {
+		return nil, err
+	}
+
+	var parts []string
+	if rawId != "" && len(t.PrimaryKey) == 1 {
+		// одиночный ключ берём целиком, в нём могут быть запятые
+		parts = []string{rawId}
+	} else if rawId != "" {
+		// значения составного ключа с запятыми можно передать через pk.$column
+		parts = strings.Split(rawId, ",")
+		if len(parts) != len(t.PrimaryKey) {
+			str := fmt.Sprintf("id must contain %d values: %s", len(t.PrimaryKey), strings.Join(t.PrimaryKey, ","))
+			return nil, DbError{statusCode: http.StatusBadRequest, err: errors.New(str)}
+		}
+	} else {
+		for _, name := range t.PrimaryKey {
+			value, ok := params[keyParamPrefix+name]
+			if !ok || len(value) != 1 {
+				str := fmt.Sprintf("missing key param %s%s", keyParamPrefix, name)
+				return nil, DbError{statusCode: http.StatusBadRequest, err: errors.New(str)}
+			}
+			parts = append(parts, value[0])
+		}
+	}
+
+	key := make(recordKey, 0, len(parts))
+	for i, part := range parts {
+		column, _ := t.Column(t.PrimaryKey[i])
+		value, err := parseParamValue(column, part)
+		if err != nil {
+			str := fmt.Sprintf("invalid value for key %s", column.Name)
+			return nil, DbError{statusCode: http.StatusBadRequest, err: errors.New(str)}
+		}
+		key = append(key, value)
+	}
+	return key, nil
+}
+
+// parseParamValue приводит значение из url (ключ, фильтр) к типу колонки
+func parseParamValue(column *Column, raw string) (interface{}, error) {
+	switch column.Kind {
+	case kindUUID:
+		return parseUUID(raw)
+	case kindUnsigned, kindBit:
+		return strconv.ParseUint(raw, 10, 64)
+	case kindBool:
+		if b, err := strconv.ParseBool(raw); err == nil {
+			value, _ := column.toDbValue(b)
+			return value, nil
+		}
+		return strconv.ParseInt(raw, 10, 64)
+	case kindInteger, kindYear:
+		return strconv.ParseInt(raw, 10, 64)
+	case kindDecimal, kindFloat:
+		if _, err := strconv.ParseFloat(raw, 64); err != nil {
+			return nil, err
+		}
+		return raw, nil // точное значение оставляем строкой, mysql приведёт сам
+	case kindBinary:
+		// в пути ключ в base64url без паддинга (/ и + ломают путь и query),
+		// обычный base64 из тела записи тоже принимаем
+		if data, err := base64.RawURLEncoding.DecodeString(raw); err == nil {
+			return data, nil
+		}
+		return base64.StdEncoding.DecodeString(raw)
+	case kindDate, kindDateTime:
+		value, ok := column.toDbValue(raw)
+		if !ok {
+			return nil, errors.New("invalid date")
+		}
+		return value, nil
+	}
+	if column.MaxLength.Valid && int64(len([]rune(raw))) > column.MaxLength.Int64 {
+		return nil, errors.New("value too long")
+	}
+	return raw, nil
+}
+
+// parseUUID принимает uuid в каноническом виде (с дефисами или без)
+// и возвращает 16 байт для колонки BINARY(16)
+func parseUUID(raw string) ([]byte, error) {
+	if len(raw) == 36 {
+		if raw[8] != '-' || raw[13] != '-' || raw[18] != '-' || raw[23] != '-' {
+			return nil, errors.New("invalid uuid")
+		}
+		raw = strings.ReplaceAll(raw, "-", "")
+	}
+	if len(raw) != 32 {
+		return nil, errors.New("invalid uuid")
+	}
+	return hex.DecodeString(raw)
+}
+
+func formatUUID(b []byte) string {
+	s := hex.EncodeToString(b)
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:32]
+}
+
+// keyCondition - условие WHERE для поиска записи по ключу
+func (t *Table) keyCondition(key recordKey) (string, []interface{}) {
+	conditions := make([]string, 0, len(t.PrimaryKey))
+	for _, name := range t.PrimaryKey {
+		conditions = append(conditions, quoteIdent(name)+" = ?")
+	}
+	return strings.Join(conditions, " AND "), key
+}
+
+// recordPath - путь к записи /$table/$id по значениям ключа из ответа на вставку
+func (s *Schema) recordPath(table *Table, record map[string]interface{}) string {
+	values := make([]string, 0, len(table.PrimaryKey))
+	for _, name := range table.PrimaryKey {
+		value := fmt.Sprint(record[name])
+		if column, _ := table.Column(name); column.Kind == kindBinary {
+			// в записи binary - обычный base64, в пути - base64url
+			if data, err := base64.StdEncoding.DecodeString(value); err == nil {
+				value = base64.RawURLEncoding.EncodeToString(data)
+			}
+		}
+		values = append(values, url.PathEscape(value))
+	}
+	return "/" + s.RouteName(table) + "/" + strings.Join(values, ",")
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Column - описание колонки, как его отдаёт information_schema.COLUMNS
+type Column struct {
+	Name          string
+	DataType      string // int, varchar, text ...
+	ColumnType    string // полный тип: int(11) unsigned, enum('a','b') ...
+	IsNullable    bool
+	Default       sql.NullString
+	Key           string // PRI, UNI, MUL или пусто
+	AutoIncrement bool
+	MaxLength     sql.NullInt64 // CHARACTER_MAXIMUM_LENGTH
+	Kind          columnKind
+	Type          reflect.Type // тип значения в json-ответе
+}
+
+type Index struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Unique  bool     `json:"unique"`
+}
+
+type ForeignKey struct {
+	Name               string   `json:"name"`
+	Columns            []string `json:"columns"`
+	ReferencedDatabase string   `json:"referenced_database"`
+	ReferencedTable    string   `json:"referenced_table"`
+	ReferencedColumns  []string `json:"referenced_columns"`
+}
+
+type Table struct {
+	Database    string
+	Name        string
+	Columns     []*Column // в порядке ORDINAL_POSITION
+	PrimaryKey  []string  // пусто, если у таблицы нет первичного ключа
+	Indexes     []*Index
+	ForeignKeys []*ForeignKey
+
+	columns map[string]*Column
+}
+
+func (t *Table) Column(name string) (*Column, bool) {
+	column, ok := t.columns[name]
+	return column, ok
+}
+
+func (t *Table) ColumnNames() []string {
+	names := make([]string, 0, len(t.Columns))
+	for _, column := range t.Columns {
+		names = append(names, column.Name)
+	}
+	return names
+}
+
+func (t *Table) IsPrimaryKey(name string) bool {
+	return Contains(t.PrimaryKey, name)
+}
+
+// requirePrimaryKey - таблицы без первичного ключа доступны только на чтение списком
+func (t *Table) requirePrimaryKey() error {
+	if len(t.PrimaryKey) == 0 {
+		str := fmt.Sprintf("table %s has no primary key", t.Name)
+		return DbError{statusCode: http.StatusBadRequest, err: errors.New(str)}
+	}
+	return nil
+}
+
+// FullName - имя таблицы вместе с базой, готовое для подстановки в запрос
+func (t *Table) FullName() string {
+	return quoteIdent(t.Database) + "." + quoteIdent(t.Name)
+}
+
+// Schema - закэшированная структура всех баз, таблиц и колонок.
+// Собирается один раз в NewDbExplorer и пересобирается только через Reload.
+type Schema struct {
+	Databases map[string]map[string]*Table
+}
+
+// FindTable ищет таблицу по короткому имени во всех базах.
+// Если таблица с таким именем есть в нескольких базах - нужно указать базу явно.
+func (s *Schema) FindTable(tableName string) (*Table, error) {
+	var found *Table
+	for _, tables := range s.Databases {
+		if table, ok := tables[tableName]; ok {
+			if found != nil {
+				str := fmt.Sprintf("table %s is ambiguous, use /$database/%s", tableName, tableName)
+				return nil, DbError{err: errors.New(str), statusCode: http.StatusConflict}
+			}
+			found = table
+		}
+	}
+	if found == nil {
+		return nil, DbError{err: errors.New("unknown table"), statusCode: http.StatusNotFound}
+	}
+	return found, nil
+}
+
+// ResolveTable находит таблицу по началу пути и возвращает остаток сегментов
+func (s *Schema) ResolveTable(segments []string) (*Table, []string, error) {
+	if len(segments) >= 2 {
+		if table, ok := s.Databases[segments[0]][segments[1]]; ok {
+			return table, segments[2:], nil
+		}
+	}
+	table, err := s.FindTable(segments[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	return table, segments[1:], nil
+}
+
+// RouteName - имя для короткого маршрута /$table, для неоднозначных имён - $database/$table
+func (s *Schema) RouteName(table *Table) string {
+	if found, err := s.FindTable(table.Name); err == nil && found == table {
+		return table.Name
+	}
+	return table.Database + "/" + table.Name
+}
+
+// RouteNames - отсортированные имена всех таблиц, по которым к ним можно обратиться
+func (s *Schema) RouteNames() []string {
+	names := make([]string, 0)
+	for _, tables := range s.Databases {
+		for _, table := range tables {
+			names = append(names, s.RouteName(table))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TableNames - имена таблиц, сгруппированные по базам
+func (s *Schema) TableNames() map[string][]string {
+	res := make(map[string][]string, len(s.Databases))
+	for databaseName, tables := range s.Databases {
+		names := make([]string, 0, len(tables))
+		for name := range tables {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		res[databaseName] = names
+	}
+	return res
+}
+
+func (s *Schema) TablesCount() int {
+	count := 0
+	for _, tables := range s.Databases {
+		count += len(tables)
+	}
+	return count
+}
+
+// TableInfo - краткое описание таблицы для GET /?meta=1
+type TableInfo struct {
+	Database   string   `json:"database"`
+	Name       string   `json:"name"`
+	Rows       int64    `json:"rows"` // оценка из information_schema, не COUNT(*)
+	PrimaryKey []string `json:"primary_key"`
+	Columns    int      `json:"columns"`
+}
+
+func loadSchema(db *sql.DB, visibility visibility) (*Schema, error) {
+	// одним запросом забираем колонки всех таблиц *всех баз данных*
+	rows, err := db.Query(
+		"SELECT c.TABLE_SCHEMA, c.TABLE_NAME, c.COLUMN_NAME, c.DATA_TYPE, c.COLUMN_TYPE, " +
+			"c.IS_NULLABLE, c.COLUMN_DEFAULT, c.COLUMN_KEY, c.EXTRA, c.CHARACTER_MAXIMUM_LENGTH " +
+			"FROM information_schema.COLUMNS c " +
+			"JOIN information_schema.TABLES t ON t.TABLE_SCHEMA = c.TABLE_SCHEMA AND t.TABLE_NAME = c.TABLE_NAME " +
+			"WHERE t.TABLE_TYPE = 'BASE TABLE' " +
+			"AND t.TABLE_SCHEMA NOT IN ('mysql', 'information_schema', 'performance_schema', 'sys') " +
+			"ORDER BY c.TABLE_SCHEMA, c.TABLE_NAME, c.ORDINAL_POSITION")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schema := &Schema{Databases: make(map[string]map[string]*Table)}
+	for rows.Next() {
+		var databaseName, tableName, isNullable, extra string
+		column := &Column{}
+		err := rows.Scan(&databaseName, &tableName, &column.Name, &column.DataType, &column.ColumnType,
+			&isNullable, &column.Default, &column.Key, &extra, &column.MaxLength)
+		if err != nil {
+			return nil, err
+		}
+		if !visibility.isExposed(databaseName, tableName) {
+			continue
+		}
+		column.IsNullable = isNullable == "YES"
+		column.AutoIncrement = strings.Contains(extra, "auto_increment")
+		column.Kind = toColumnKind(column.DataType, column.ColumnType)
+		column.Type = toGoNativeType(column.Kind)
+
+		tables := schema.Databases[databaseName]
+		if tables == nil {
+			tables = make(map[string]*Table)
+			schema.Databases[databaseName] = tables
+		}
+		table := tables[tableName]
+		if table == nil {
+			table = &Table{Database: databaseName, Name: tableName, columns: make(map[string]*Column)}
+			tables[tableName] = table
+		}
+		table.Columns = append(table.Columns, column)
+		table.columns[column.Name] = column
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err = loadPrimaryKeys(db, schema); err != nil {
+		return nil, err
+	}
+	if err = loadIndexes(db, schema); err != nil {
+		return nil, err
+	}
+	if err = loadForeignKeys(db, schema); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+func loadPrimaryKeys(db *sql.DB, schema *Schema) error {
+	// порядок колонок составного ключа есть только в KEY_COLUMN_USAGE
+	rows, err := db.Query(
+		"SELECT TABLE_SCHEMA, TABLE_NAME, COLUMN_NAME " +
+			"FROM information_schema.KEY_COLUMN_USAGE " +
+			"WHERE CONSTRAINT_NAME = 'PRIMARY' " +
+			"AND TABLE_SCHEMA NOT IN ('mysql', 'information_schema', 'performance_schema', 'sys') " +
+			"ORDER BY TABLE_SCHEMA, TABLE_NAME, ORDINAL_POSITION")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var databaseName, tableName, columnName string
+		if err := rows.Scan(&databaseName, &tableName, &columnName); err != nil {
+			return err
+		}
+		if table, ok := schema.Databases[databaseName][tableName]; ok {
+			table.PrimaryKey = append(table.PrimaryKey, columnName)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	// без явного PRIMARY KEY mysql помечает как PRI первый уникальный NOT NULL индекс
+	for _, tables := range schema.Databases {
+		for _, table := range tables {
+			if len(table.PrimaryKey) > 0 {
+				continue
+			}
+			for _, column := range table.Columns {
+				if column.Key == "PRI" {
+					table.PrimaryKey = append(table.PrimaryKey, column.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func loadIndexes(db *sql.DB, schema *Schema) error {
+	rows, err := db.Query(
+		"SELECT TABLE_SCHEMA, TABLE_NAME, INDEX_NAME, NON_UNIQUE, COLUMN_NAME " +
+			"FROM information_schema.STATISTICS " +
+			"WHERE TABLE_SCHEMA NOT IN ('mysql', 'information_schema', 'performance_schema', 'sys') " +
+			"ORDER BY TABLE_SCHEMA, TABLE_NAME, INDEX_NAME, SEQ_IN_INDEX")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var databaseName, tableName, indexName string
+		var nonUnique int64
+		var columnName sql.NullString // NULL у функциональных индексов
+		if err := rows.Scan(&databaseName, &tableName, &indexName, &nonUnique, &columnName); err != nil {
+			return err
+		}
+		table, ok := schema.Databases[databaseName][tableName]
+		if !ok || !columnName.Valid {
+			continue
+		}
+		count := len(table.Indexes)
+		if count == 0 || table.Indexes[count-1].Name != indexName {
+			table.Indexes = append(table.Indexes, &Index{Name: indexName, Unique: nonUnique == 0})
+			count++
+		}
+		index := table.Indexes[count-1]
+		index.Columns = append(index.Columns, columnName.String)
+	}
+	return rows.Err()
+}
+
+func loadForeignKeys(db *sql.DB, schema *Schema) error {
+	rows, err := db.Query(
+		"SELECT TABLE_SCHEMA, TABLE_NAME, CONSTRAINT_NAME, COLUMN_NAME, " +
+			"REFERENCED_TABLE_SCHEMA, REFERENCED_TABLE_NAME, REFERENCED_COLUMN_NAME " +
+			"FROM information_schema.KEY_COLUMN_USAGE " +
+			"WHERE REFERENCED_TABLE_NAME IS NOT NULL " +
+			"AND TABLE_SCHEMA NOT IN ('mysql', 'information_schema', 'performance_schema', 'sys') " +
+			"ORDER BY TABLE_SCHEMA, TABLE_NAME, CONSTRAINT_NAME, ORDINAL_POSITION")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var databaseName, tableName, constraintName, columnName string
+		var referencedDatabase, referencedTable, referencedColumn string
+		err := rows.Scan(&databaseName, &tableName, &constraintName, &columnName,
+			&referencedDatabase, &referencedTable, &referencedColumn)
+		if err != nil {
+			return err
+		}
+		table, ok := schema.Databases[databaseName][tableName]
+		if !ok {
+			continue
+		}
+		count := len(table.ForeignKeys)
+		if count == 0 || table.ForeignKeys[count-1].Name != constraintName {
+			table.ForeignKeys = append(table.ForeignKeys, &ForeignKey{
+				Name:               constraintName,
+				ReferencedDatabase: referencedDatabase,
+				ReferencedTable:    referencedTable,
+			})
+			count++
+		}
+		foreignKey := table.ForeignKeys[count-1]
+		foreignKey.Columns = append(foreignKey.Columns, columnName)
+		foreignKey.ReferencedColumns = append(foreignKey.ReferencedColumns, referencedColumn)
+	}
+	return rows.Err()
+}
+
+func quoteIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+func quoteIdents(names []string) []string {
+	res := make([]string, 0, len(names))
+	for _, name := range names {
+		res = append(res, quoteIdent(name))
+	}
+	return res
+}
+
+func (exp *DbExplorer) getSchema() *Schema {
+	exp.mu.RLock()
+	defer exp.mu.RUnlock()
+	return exp.schema
+}
+
+// Reload перечитывает структуру базы, например после ALTER/CREATE TABLE
+func (exp *DbExplorer) Reload() error {
+	schema, err := loadSchema(exp.db, exp.visibility)
+	if err != nil {
+		return err
+	}
+	exp.mu.Lock()
+	exp.schema = schema
+	exp.mu.Unlock()
+	return nil
+}
+
+// tablesInfo собирает TableInfo по всем таблицам схемы, ключ - RouteName
+func (exp *DbExplorer) tablesInfo(schema *Schema) (map[string]TableInfo, error) {
+	rows, err := exp.db.Query(
+		"SELECT TABLE_SCHEMA, TABLE_NAME, COALESCE(TABLE_ROWS, 0) " +
+			"FROM information_schema.TABLES " +
+			"WHERE TABLE_TYPE = 'BASE TABLE' " +
+			"AND TABLE_SCHEMA NOT IN ('mysql', 'information_schema', 'performance_schema', 'sys')")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make(map[string]TableInfo)
+	for rows.Next() {
+		var databaseName, tableName string
+		var tableRows int64
+		if err := rows.Scan(&databaseName, &tableName, &tableRows); err != nil {
+			return nil, err
+		}
+		table, ok := schema.Databases[databaseName][tableName]
+		if !ok {
+			continue
+		}
+		primaryKey := table.PrimaryKey
+		if primaryKey == nil {
+			primaryKey = []string{}
+		}
+		res[schema.RouteName(table)] = TableInfo{
+			Database:   databaseName,
+			Name:       tableName,
+			Rows:       tableRows,
+			PrimaryKey: primaryKey,
+			Columns:    len(table.Columns),
+		}
+	}
+	return res, rows.Err()
+}
+
+func (exp *DbExplorer) reloadFunc(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if err := exp.Reload(); err != nil {
+		HandleError(w, DbError{statusCode: http.StatusInternalServerError, err: fmt.Errorf("reload schema: %w", err)})
+		return
+	}
+	data := make(map[string]interface{})
+	data["tables"] = exp.getSchema().TablesCount()
+	SendResponse(w, data)
+}
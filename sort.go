@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type sortField struct {
+	column string
+	desc   bool
+}
+
+// Sort - порядок строк для ORDER BY, всегда заканчивается первичным ключом
+type Sort []sortField
+
+// parseSort разбирает ?sort=-updated,id: минус - по убыванию.
+// Колонки ключа дописываются в конец, чтобы порядок был однозначным
+// и limit/offset не терял и не дублировал строки между страницами.
+func (t *Table) parseSort(raw string) (Sort, error) {
+	sort := make(Sort, 0)
+	seen := make(map[string]bool)
+	if raw != "" {
+		for _, part := range strings.Split(raw, ",") {
+			field := sortField{column: strings.TrimSpace(part)}
+			if strings.HasPrefix(field.column, "-") {
+				field.column = field.column[1:]
+				field.desc = true
+			} else {
+				field.column = strings.TrimPrefix(field.column, "+")
+			}
+			if _, ok := t.Column(field.column); !ok {
+				str := fmt.Sprintf("unknown sort column %s", field.column)
+				return nil, DbError{statusCode: http.StatusBadRequest, err: errors.New(str)}
+			}
+			if seen[field.column] {
+				continue
+			}
+			seen[field.column] = true
+			sort = append(sort, field)
+		}
+	}
+	for _, name := range t.PrimaryKey {
+		if !seen[name] {
+			sort = append(sort, sortField{column: name})
+		}
+	}
+	return sort, nil
+}
+
+func (s Sort) orderBy() string {
+	fields := make([]string, 0, len(s))
+	for _, field := range s {
+		if field.desc {
+			fields = append(fields, quoteIdent(field.column)+" DESC")
+		} else {
+			fields = append(fields, quoteIdent(field.column))
+		}
+	}
+	return strings.Join(fields, ", ")
+}
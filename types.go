@@ -0,0 +1,369 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// columnKind - к чему сводим всё многообразие типов mysql
+type columnKind string
+
+const (
+	kindString   columnKind = "string"
+	kindInteger  columnKind = "integer"
+	kindUnsigned columnKind = "unsigned"
+	kindBool     columnKind = "bool" // tinyint(1)
+	kindDecimal  columnKind = "decimal"
+	kindFloat    columnKind = "float"
+	kindDate     columnKind = "date"
+	kindDateTime columnKind = "datetime"
+	kindTime     columnKind = "time"
+	kindYear     columnKind = "year"
+	kindJSON     columnKind = "json"
+	kindEnum     columnKind = "enum"
+	kindSet      columnKind = "set"
+	kindBinary   columnKind = "binary"
+	kindUUID     columnKind = "uuid" // binary(16)
+	kindBit      columnKind = "bit"
+	kindUnknown  columnKind = "unknown"
+)
+
+const (
+	mysqlDateLayout     = "2006-01-02"
+	mysqlDateTimeLayout = "2006-01-02 15:04:05" // дробная часть секунд при разборе допускается
+)
+
+// toColumnKind определяет вид колонки по DATA_TYPE и COLUMN_TYPE из information_schema
+func toColumnKind(dataType, columnType string) columnKind {
+	unsigned := strings.Contains(columnType, "unsigned")
+	switch dataType {
+	case "char", "varchar", "tinytext", "text", "mediumtext", "longtext":
+		return kindString
+	case "tinyint":
+		if strings.HasPrefix(columnType, "tinyint(1)") {
+			return kindBool
+		}
+		fallthrough
+	case "smallint", "mediumint", "int", "integer", "bigint":
+		if unsigned {
+			return kindUnsigned
+		}
+		return kindInteger
+	case "decimal", "numeric":
+		return kindDecimal
+	case "float", "double", "real":
+		return kindFloat
+	case "date":
+		return kindDate
+	case "datetime", "timestamp":
+		return kindDateTime
+	case "time":
+		return kindTime
+	case "year":
+		return kindYear
+	case "json":
+		return kindJSON
+	case "enum":
+		return kindEnum
+	case "set":
+		return kindSet
+	case "binary":
+		if columnType == "binary(16)" {
+			return kindUUID
+		}
+		return kindBinary
+	case "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		return kindBinary
+	case "bit":
+		return kindBit
+	}
+	return kindUnknown
+}
+
+// enumMembers разбирает допустимые значения из COLUMN_TYPE вида enum('a','b') или set('a','b')
+func enumMembers(columnType string) []string {
+	open, end := strings.Index(columnType, "("), strings.LastIndex(columnType, ")")
+	if open < 0 || end <= open {
+		return nil
+	}
+	list := columnType[open+1 : end]
+	members := make([]string, 0)
+	for i := 0; i < len(list); i++ {
+		if list[i] != '\'' {
+			continue
+		}
+		var member strings.Builder
+		for i++; i < len(list); i++ {
+			if list[i] == '\'' {
+				if i+1 < len(list) && list[i+1] == '\'' { // '' внутри значения
+					member.WriteByte('\'')
+					i++
+					continue
+				}
+				break
+			}
+			member.WriteByte(list[i])
+		}
+		members = append(members, member.String())
+	}
+	return members
+}
+
+// kindFromColumnType - вид колонки результата, которой нет в схеме (выражения, алиасы)
+func kindFromColumnType(columnType *sql.ColumnType) columnKind {
+	dataType := strings.ToLower(columnType.DatabaseTypeName())
+	fullType := dataType
+	if strings.HasPrefix(dataType, "unsigned ") {
+		dataType = strings.TrimPrefix(dataType, "unsigned ")
+		fullType = dataType + " unsigned"
+	}
+	if kind := toColumnKind(dataType, fullType); kind != kindUnknown {
+		return kind
+	}
+	if scanType := columnType.ScanType(); scanType != nil {
+		switch scanType.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return kindInteger
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return kindUnsigned
+		case reflect.Float32, reflect.Float64:
+			return kindFloat
+		}
+	}
+	return kindString
+}
+
+// toGoNativeType - тип, в котором значение колонки отдаётся наружу
+func toGoNativeType(kind columnKind) reflect.Type {
+	switch kind {
+	case kindString, kindEnum, kindSet, kindDate, kindDateTime, kindTime, kindUUID:
+		return reflect.TypeOf("")
+	case kindInteger, kindYear:
+		return reflect.TypeOf(int64(0))
+	case kindUnsigned, kindBit:
+		return reflect.TypeOf(uint64(0))
+	case kindBool:
+		return reflect.TypeOf(false)
+	case kindDecimal:
+		return reflect.TypeOf(json.Number(""))
+	case kindFloat:
+		return reflect.TypeOf(float64(0))
+	case kindJSON:
+		return reflect.TypeOf(json.RawMessage{})
+	case kindBinary:
+		return reflect.TypeOf([]byte{})
+	}
+	return nil
+}
+
+// toDbValue проверяет значение из json-тела и приводит его к виду,
+// который можно передать в запрос. false - значение не подходит колонке.
+func (c *Column) toDbValue(value interface{}) (interface{}, bool) {
+	if value == nil {
+		return nil, false
+	}
+	switch c.Kind {
+	case kindString, kindEnum, kindTime:
+		v, ok := value.(string)
+		return v, ok
+	case kindSet:
+		switch v := value.(type) {
+		case string:
+			return v, true
+		case []interface{}:
+			members := make([]string, 0, len(v))
+			for _, item := range v {
+				member, ok := item.(string)
+				if !ok {
+					return nil, false
+				}
+				members = append(members, member)
+			}
+			return strings.Join(members, ","), true
+		}
+	case kindInteger, kindYear:
+		switch v := value.(type) {
+		case int64:
+			return v, true
+		case json.Number: // 1.0 - тоже целое по json schema
+			if f, ok := bigNumber(v); ok && f.IsInt() {
+				i, accuracy := f.Int64()
+				return i, accuracy == big.Exact
+			}
+		}
+	case kindUnsigned, kindBit:
+		switch v := value.(type) {
+		case int64:
+			return uint64(v), v >= 0
+		case uint64:
+			return v, true
+		case json.Number:
+			if f, ok := bigNumber(v); ok && f.IsInt() {
+				u, accuracy := f.Uint64()
+				return u, accuracy == big.Exact
+			}
+		}
+	case kindBool:
+		switch v := value.(type) {
+		case bool:
+			if v {
+				return int64(1), true
+			}
+			return int64(0), true
+		case int64:
+			return v, true
+		}
+	case kindDecimal:
+		switch v := value.(type) {
+		case int64:
+			return strconv.FormatInt(v, 10), true
+		case uint64:
+			return strconv.FormatUint(v, 10), true
+		case json.Number:
+			// текст числа как есть, mysql приведёт его к decimal без потери точности
+			return v.String(), true
+		case string:
+			// строкой можно передать точное значение
+			_, err := strconv.ParseFloat(v, 64)
+			return v, err == nil
+		}
+	case kindFloat:
+		switch v := value.(type) {
+		case int64:
+			return float64(v), true
+		case uint64:
+			return float64(v), true
+		case json.Number:
+			f, err := v.Float64()
+			return f, err == nil
+		}
+	case kindDate:
+		if v, ok := value.(string); ok {
+			t, err := parseTime(v)
+			return t.Format(mysqlDateLayout), err == nil
+		}
+	case kindDateTime:
+		if v, ok := value.(string); ok {
+			t, err := parseTime(v)
+			return t.Format(mysqlDateTimeLayout + ".999999"), err == nil
+		}
+	case kindJSON:
+		data, err := json.Marshal(value)
+		return string(data), err == nil
+	case kindBinary:
+		if v, ok := value.(string); ok {
+			data, err := base64.StdEncoding.DecodeString(v)
+			return data, err == nil
+		}
+	case kindUUID:
+		if v, ok := value.(string); ok {
+			data, err := parseUUID(v)
+			return data, err == nil
+		}
+	}
+	return nil, false
+}
+
+// bigNumber - json-число без потери точности
+func bigNumber(num json.Number) (*big.Float, bool) {
+	f, _, err := big.ParseFloat(num.String(), 10, 512, big.ToNearestEven)
+	return f, err == nil
+}
+
+// parseTime принимает RFC 3339 и родные форматы mysql, время приводится к UTC
+func parseTime(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, mysqlDateTimeLayout, mysqlDateLayout} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+// fromDbValue превращает значение, прочитанное из базы, в значение для json-ответа
+func (c *Column) fromDbValue(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	b, isBytes := value.([]byte)
+	switch c.Kind {
+	case kindInteger, kindYear:
+		if isBytes {
+			if i, err := strconv.ParseInt(string(b), 10, 64); err == nil {
+				return i
+			}
+		}
+	case kindUnsigned:
+		if isBytes {
+			if u, err := strconv.ParseUint(string(b), 10, 64); err == nil {
+				return u
+			}
+		}
+	case kindBool:
+		if isBytes {
+			return string(b) != "0"
+		}
+		if i, ok := value.(int64); ok {
+			return i != 0
+		}
+	case kindDecimal:
+		if isBytes {
+			return json.Number(b) // число без потери точности
+		}
+	case kindFloat:
+		if isBytes {
+			if f, err := strconv.ParseFloat(string(b), 64); err == nil {
+				return f
+			}
+		}
+		if f, ok := value.(float32); ok {
+			return float64(f)
+		}
+	case kindDate, kindDateTime:
+		if t, ok := value.(time.Time); ok {
+			return formatTime(c.Kind, t)
+		}
+		if isBytes {
+			if t, err := parseTime(string(b)); err == nil {
+				return formatTime(c.Kind, t)
+			}
+			return string(b) // например 0000-00-00
+		}
+	case kindJSON:
+		if isBytes {
+			return json.RawMessage(b)
+		}
+	case kindBinary:
+		if isBytes {
+			return b // encoding/json отдаст []byte в base64
+		}
+	case kindUUID:
+		if isBytes && len(b) == 16 {
+			return formatUUID(b)
+		}
+	case kindBit:
+		if isBytes && len(b) <= 8 {
+			buf := make([]byte, 8)
+			copy(buf[8-len(b):], b)
+			return binary.BigEndian.Uint64(buf)
+		}
+	}
+	if isBytes {
+		return string(b)
+	}
+	return value
+}
+
+func formatTime(kind columnKind, t time.Time) string {
+	if kind == kindDate {
+		return t.Format(mysqlDateLayout) // full-date из RFC 3339
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Изменение и удаление по фильтру: PATCH /$table?filter... и DELETE /$table?filter...
+// Фильтр обязателен и разбирается так же, как в списке. ?dry_run=1 только считает
+// подходящие строки. Если строк больше maxAffectedRows, ничего не меняется.
+
+const defaultMaxAffectedRows = 1000
+
+// requireFilter - фильтр из запроса, без фильтра менять всю таблицу не даём
+func (t *Table) requireFilter(r *http.Request) (Filter, error) {
+	filter, err := t.parseFilter(r.URL.Query())
+	if err != nil {
+		return nil, err
+	}
+	if len(filter) == 0 {
+		return nil, DbError{statusCode: http.StatusBadRequest, err: errors.New("filter is required"), code: "filter_required"}
+	}
+	return filter, nil
+}
+
+// execWhere выполняет statement с условием фильтра в транзакции: сначала блокирует
+// и считает подходящие строки, при превышении лимита откатывает. Для dry run только считает.
+func (exp *DbExplorer) execWhere(table *Table, filter Filter, dryRun bool, statement string, args []interface{}) (int64, int64, error) {
+	condition, filterArgs := filter.where()
+
+	var matched int64
+	if dryRun {
+		countQuery := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s", table.FullName(), condition)
+		if err := exp.db.QueryRow(countQuery, filterArgs...).Scan(&matched); err != nil {
+			return 0, 0, DbError{statusCode: http.StatusInternalServerError, err: err}
+		}
+		return matched, 0, nil
+	}
+
+	tx, err := exp.db.Begin()
+	if err != nil {
+		return 0, 0, DbError{statusCode: http.StatusInternalServerError, err: err}
+	}
+	defer tx.Rollback()
+
+	// блокируем не больше limit+1 строк: этого хватает, чтобы понять, что лимит превышен,
+	// и большая таблица не блокируется целиком ради отказа
+	lockQuery := fmt.Sprintf("SELECT COUNT(*) FROM (SELECT 1 FROM %s WHERE %s LIMIT %d FOR UPDATE) AS matched",
+		table.FullName(), condition, exp.maxAffectedRows+1)
+	if err := tx.QueryRow(lockQuery, filterArgs...).Scan(&matched); err != nil {
+		return 0, 0, DbError{statusCode: http.StatusInternalServerError, err: err}
+	}
+	if matched > int64(exp.maxAffectedRows) {
+		str := fmt.Sprintf("filter matches more than %d rows", exp.maxAffectedRows)
+		return 0, 0, DbError{statusCode: http.StatusBadRequest, err: errors.New(str), code: "limit_exceeded"}
+	}
+
+	var result sql.Result
+	if result, err = tx.Exec(statement+" WHERE "+condition, append(args, filterArgs...)...); err != nil {
+		return matched, 0, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return matched, 0, DbError{statusCode: http.StatusInternalServerError, err: err}
+	}
+	if err := tx.Commit(); err != nil {
+		return matched, 0, DbError{statusCode: http.StatusInternalServerError, err: err}
+	}
+	return matched, affected, nil
+}
+
+func (exp *DbExplorer) UpdateWhere(w http.ResponseWriter, r *http.Request, table *Table) {
+	if err := table.requirePrimaryKey(); err != nil {
+		HandleError(w, err)
+		return
+	}
+	filter, err := table.requireFilter(r)
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+
+	body, err := jsonBodyParser(r.Body)
+	r.Body.Close()
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+
+	keys, values, err := exp.Validate(body, table, payloadUpdate)
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+	if len(keys) == 0 {
+		HandleError(w, DbError{statusCode: http.StatusBadRequest, err: errors.New("nothing to update")})
+		return
+	}
+
+	setValues := make([]string, 0, len(keys))
+	for _, name := range keys {
+		setValues = append(setValues, quoteIdent(name)+" = ?")
+	}
+	statement := fmt.Sprintf("UPDATE %s SET %s", table.FullName(), strings.Join(setValues, ", "))
+	dryRun := retrieveFlag(r.URL.Query().Get("dry_run"))
+	matched, affected, err := exp.execWhere(table, filter, dryRun, statement, values)
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["matched"] = matched
+	if dryRun {
+		data["dry_run"] = true
+	} else {
+		data["updated"] = affected
+	}
+	SendResponse(w, data)
+}
+
+func (exp *DbExplorer) DeleteWhere(w http.ResponseWriter, r *http.Request, table *Table) {
+	if err := table.requirePrimaryKey(); err != nil {
+		HandleError(w, err)
+		return
+	}
+	filter, err := table.requireFilter(r)
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+
+	statement := fmt.Sprintf("DELETE FROM %s", table.FullName())
+	dryRun := retrieveFlag(r.URL.Query().Get("dry_run"))
+	matched, affected, err := exp.execWhere(table, filter, dryRun, statement, nil)
+	if err != nil {
+		HandleError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["matched"] = matched
+	if dryRun {
+		data["dry_run"] = true
+	} else {
+		data["deleted"] = affected
+	}
+	SendResponse(w, data)
+}